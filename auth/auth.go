@@ -2,32 +2,29 @@ package auth
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
+
+	"github.com/starkandwayne/safe/vault"
 )
 
 func authurl(base, f string, args ...interface{}) string {
 	return base + fmt.Sprintf(f, args...)
 }
 
-func authenticate(req *http.Request) (string, error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: os.Getenv("VAULT_SKIP_VERIFY") != "",
-			},
-		},
+func authenticate(ctx context.Context, req *http.Request) (string, error) {
+	client, err := vault.NewClient()
+	if err != nil {
+		return "", err
 	}
+	req = req.WithContext(ctx)
 
 	var (
 		body []byte
-		err  error
 		res  *http.Response
 	)
 	if req.Body != nil {
@@ -37,31 +34,39 @@ func authenticate(req *http.Request) (string, error) {
 		}
 	}
 
-	for i := 0; i < 10; i++ {
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	origin := req.URL
+	for i := 0; ; i++ {
 		if req.Body != nil {
 			req.Body = ioutil.NopCloser(bytes.NewReader(body))
 		}
 		res, err = client.Do(req)
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
 			return "", err
 		}
 
 		// Vault returns a 307 to redirect during HA / Auth
-		if res.StatusCode == 307 {
-			// Note: this does not handle relative Location headers
-			u, err := url.Parse(res.Header.Get("Location"))
-			if err != nil {
-				return "", err
-			}
-			req.URL = u
-			// ... and try again.
-			continue
+		if !vault.IsRedirect(res) {
+			break
+		}
+		res.Body.Close()
+		if i >= vault.MaxRedirects {
+			return "", fmt.Errorf("redirection loop detected")
+		}
+		if err = vault.FollowRedirect(req, res, origin); err != nil {
+			return "", err
 		}
-		break
+		// ... and try again.
 	}
 
 	if res.StatusCode != 200 {
-		return "", fmt.Errorf("API %s", res.Status)
+		return "", vault.NewAPIError(res)
 	}
 
 	b, err := ioutil.ReadAll(res.Body)
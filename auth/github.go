@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -8,7 +9,7 @@ import (
 	"github.com/starkandwayne/safe/prompt"
 )
 
-func Github(addr string) (string, error) {
+func Github(ctx context.Context, addr string) (string, error) {
 	access := prompt.Secure("Github Personal Access Token: ")
 
 	body := struct {
@@ -25,5 +26,5 @@ func Github(addr string) (string, error) {
 		return "", err
 	}
 
-	return authenticate(req)
+	return authenticate(ctx, req)
 }
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -8,7 +9,7 @@ import (
 	"github.com/starkandwayne/safe/prompt"
 )
 
-func LDAP(addr string) (string, error) {
+func LDAP(ctx context.Context, addr string) (string, error) {
 	username := prompt.Normal("LDAP username: ")
 	password := prompt.Secure("Password: ")
 
@@ -26,5 +27,5 @@ func LDAP(addr string) (string, error) {
 		return "", err
 	}
 
-	return authenticate(req)
+	return authenticate(ctx, req)
 }
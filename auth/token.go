@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"context"
+
 	"github.com/starkandwayne/safe/prompt"
 )
 
-func Token(addr string) (string, error) {
+func Token(ctx context.Context, addr string) (string, error) {
 	return prompt.Secure("Token: "), nil
 }
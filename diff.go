@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+)
+
+// diffContext is how many unchanged lines to show around each change.
+const diffContext = 2
+
+// diff prints the differences between two texts, line by line, with
+// removed lines in red and added lines in green, and a few unchanged
+// lines around each change.  Lines are matched up via their longest
+// common subsequence.
+func diff(a, b string) {
+	x, y := diffLines(a), diffLines(b)
+
+	/* lcs[i][j] is the length of the longest common subsequence
+	   of x[i:] and y[j:] */
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			edits = append(edits, edit{' ', x[i]})
+			i++
+			j++
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', x[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', y[j]})
+			j++
+		}
+	}
+
+	show := make([]bool, len(edits))
+	for k, e := range edits {
+		if e.op == ' ' {
+			continue
+		}
+		for n := k - diffContext; n <= k+diffContext; n++ {
+			if n >= 0 && n < len(edits) {
+				show[n] = true
+			}
+		}
+	}
+
+	skipped := false
+	for k, e := range edits {
+		if !show[k] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			ansi.Printf("@C{  ...}\n")
+			skipped = false
+		}
+		switch e.op {
+		case '-':
+			ansi.Printf("@R{- %s}\n", e.line)
+		case '+':
+			ansi.Printf("@G{+ %s}\n", e.line)
+		default:
+			if e.line == "" {
+				fmt.Printf("\n")
+			} else {
+				fmt.Printf("  %s\n", e.line)
+			}
+		}
+	}
+	if skipped {
+		ansi.Printf("@C{  ...}\n")
+	}
+}
+
+func diffLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -2,27 +2,48 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http/httputil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/pborman/getopt"
 	"github.com/starkandwayne/goutils/ansi"
 
 	"github.com/starkandwayne/safe/auth"
+	"github.com/starkandwayne/safe/prompt"
 	"github.com/starkandwayne/safe/rc"
 	"github.com/starkandwayne/safe/vault"
 )
 
 var Version string
 
+// ctx is cancelled on Ctrl-C, so that in-flight requests to the Vault
+// can be abandoned, and commands can clean up after themselves.
+var ctx = context.Background()
+
+// connect returns a client for the currently targeted Vault, after
+// checking that the token isn't about to expire (see checkToken).
 func connect() *vault.Vault {
+	v := dial(true)
+	checkToken(v)
+	return v
+}
+
+// dial returns a client for the currently targeted Vault, bailing out
+// if there isn't one, or (if auth is set) if we aren't authenticated to
+// it.  Without auth, the client can only be used for the parts of the
+// Vault API that don't need a token.
+func dial(auth bool) *vault.Vault {
 	addr := os.Getenv("VAULT_ADDR")
 	if addr == "" {
 		ansi.Fprintf(os.Stderr, "@R{You are not targeting a Vault.}\n")
@@ -31,6 +52,15 @@ func connect() *vault.Vault {
 		os.Exit(1)
 	}
 
+	if !auth {
+		v, err := vault.NewUnauthenticatedVault(addr)
+		if err != nil {
+			ansi.Fprintf(os.Stderr, "@R{!! %s}\n", err)
+			os.Exit(1)
+		}
+		return v
+	}
+
 	if os.Getenv("VAULT_TOKEN") == "" {
 		ansi.Fprintf(os.Stderr, "@R{You are not authenticated to a Vault.}\n")
 		ansi.Fprintf(os.Stderr, "Try @C{safe auth ldap}\n")
@@ -47,8 +77,48 @@ func connect() *vault.Vault {
 	return v
 }
 
+// checkToken warns if the current token is going to expire soon (within
+// $SAFE_TOKEN_WARN, an hour by default), so that it doesn't come as a
+// surprise.  If $SAFE_TOKEN_RENEW is set, renewable tokens are renewed
+// instead.  Any problems looking up the token are left for the command
+// itself to run into.
+func checkToken(v *vault.Vault) {
+	window := time.Hour
+	if d, err := time.ParseDuration(os.Getenv("SAFE_TOKEN_WARN")); err == nil {
+		window = d
+	}
+	if window <= 0 {
+		return
+	}
+
+	info, err := v.LookupSelf(ctx)
+	if err != nil || info.TTL == 0 || info.TTL >= window {
+		return
+	}
+
+	renew := os.Getenv("SAFE_TOKEN_RENEW")
+	if info.Renewable && renew != "" && renew != "0" && renew != "false" && renew != "no" && renew != "off" {
+		ttl, err := v.RenewSelf(ctx, 0)
+		if err == nil {
+			ansi.Fprintf(os.Stderr, "@G{Renewed your Vault token; it is now valid for %s}\n", ttl)
+			return
+		}
+		ansi.Fprintf(os.Stderr, "@Y{Unable to renew your Vault token: %s}\n", err)
+	}
+
+	ansi.Fprintf(os.Stderr, "@Y{Your Vault token expires in %s.}\n", info.TTL)
+	if info.Renewable {
+		ansi.Fprintf(os.Stderr, "Try @C{safe renew}, or @C{safe auth} to log in again\n")
+	} else {
+		ansi.Fprintf(os.Stderr, "Try @C{safe auth} to log in again\n")
+	}
+}
+
 func main() {
-	go Signals()
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	go Signals(cancel)
 
 	r := NewRunner()
 	r.Dispatch("version", func(command string, args ...string) error {
@@ -69,21 +139,203 @@ func main() {
     targets
            List all Vaults that have been targeted.
 
-    target [vault-address] name
-           Target a new or existing Vault.
+    target [--namespace ns] [vault-address] name
+           Target a new or existing Vault.  For Vault Enterprise, the
+           --namespace flag sets the namespace to use for that Vault
+           (overriding $VAULT_NAMESPACE); pass an empty namespace to clear it.
+
+           --ca-cert, --ca-path, --client-cert, --client-key and
+           --tls-server-name set how to verify the Vault's certificate,
+           and which client certificate to present to it (overriding
+           $VAULT_CACERT, $VAULT_CAPATH, $VAULT_CLIENT_CERT,
+           $VAULT_CLIENT_KEY and $VAULT_TLS_SERVER_NAME).  Pass an empty
+           value to clear any of them.
 
     auth [token|ldap|github]
            Authenticate against the currently targeted Vault.
 
-    get path [path ...]
-           Retrieve and print the values of one or more paths.
+    logout [--all]
+           Revoke the token you are authenticated with, and forget it.
+           With --all, log out of every Vault you have targeted.
+
+    status [--all]
+           Show whether or not the currently targeted Vault (or, with
+           --all, every Vault that has been targeted) is sealed, and
+           which node of an HA cluster is active.
+
+    init [--shares 5] [--threshold 3] [--sealed] [--persist path]
+           Initialize a brand new Vault, printing its unseal keys and
+           root token, and unseal it (unless --sealed).  The root token
+           becomes the token for the current target.  --persist also
+           stores the keys and root token in the Vault, at that path;
+           only ever do this with lab / development Vaults.
+
+    unseal
+           Unseal the currently targeted Vault, prompting for as many
+           unseal keys as it needs.
+
+    seal
+           Seal the currently targeted Vault.
+
+    rekey [init|status|cancel] [--shares 5] [--threshold 3]
+          [--pgp-key file,...] [--backup]
+           Split the currently targeted Vault's master key into a new
+           set of unseal keys, optionally encrypted with PGP keys (one
+           per key).  Each operator runs 'safe rekey' to provide their
+           current unseal key; the new keys are printed once enough
+           have been provided.  'init' only starts the rekey.
+
+    generate-root [init|status|cancel] [--pgp-key file] [--otp password]
+           Generate a new root token for the currently targeted Vault,
+           from its unseal keys.  Each operator runs 'safe generate-root'
+           to provide their key.  The root token is encrypted with the
+           PGP key, if given, or encoded with a one-time password, which
+           is printed when the generation starts.
+
+    generate-root decode --otp password encoded-token
+           Decode a root token, as generated by generate-root.  The
+           targeted Vault is asked how it encodes its root tokens.
+
+    mounts
+           List the secrets engines mounted in the currently targeted Vault.
+
+    mount [--kv-version 2] [--description text] [--default-lease-ttl ttl]
+          [--max-lease-ttl ttl] type path
+           Mount a new secrets engine of the given type (i.e. kv or pki)
+           at path.  --kv-version sets the KV version of kv mounts.
+
+    unmount [-f] path
+           Unmount the secrets engine at path, deleting all of its secrets
+           (after asking for confirmation, unless -f is given).
+
+    tune [--kv-version 2] [--description text] [--default-lease-ttl ttl]
+         [--max-lease-ttl ttl] path
+           Change the settings of the secrets engine mounted at path.
+           Tuning a KV version 1 mount to --kv-version 2 upgrades it.
+
+    remount oldpath newpath
+           Move the secrets engine mounted at oldpath to newpath.
+
+    policy list
+    policy get name
+    policy set name [file]
+    policy delete name [name ...]
+           Manage ACL policies.  set reads the policy (in HCL) from file,
+           or from standard input.
+
+    policy apply [--prune] [--dry-run] dir
+           Update the ACL policies in the Vault to match the *.hcl files in
+           dir (one per policy, named after it), showing what changed.
+           --prune deletes policies that are not in dir (except for root
+           and default), and --dry-run only shows what would change.
+
+    transit keys [name]
+    transit create [--type aes256-gcm96] name
+    transit rotate name
+    transit config [--min-decryption-version N] [--min-encryption-version N]
+                   [--deletion-allowed true|false] [--exportable] name
+           Manage the encryption keys of Vault's transit backend.  Without
+           a name, 'keys' lists them all.
+
+    encrypt [--batch] [--key-version N] key [file|-]
+           Encrypt a file (or standard input) with a transit key, printing
+           the ciphertext.  With --batch, each line is encrypted separately.
+
+    decrypt [--batch] key [file|-]
+           Decrypt a ciphertext (or, with --batch, one per line) from a file
+           (or standard input) with a transit key.
+
+    rewrap [--key-version N] key [file|-]
+           Re-encrypt ciphertexts (one per line) with the latest version of
+           a transit key (or --key-version), without decrypting them.
+
+    seal-file [--values] key [file|-]
+           Encrypt a file (or standard input) locally, with a new data key
+           from the transit backend, wrapped with the given transit key and
+           stored alongside the encrypted data.  With --values, only the
+           values of a YAML or JSON document are encrypted.
+
+    unseal-file [file|-]
+           Decrypt a file sealed by seal-file.
+
+           All of the transit commands (and seal-file) use the transit
+           backend mounted at transit/, unless given another with --backend.
+
+    whoami
+           Show the name, policies and remaining time to live of the token
+           you are authenticated with.
+
+    renew [increment]
+           Renew the token you are authenticated with, optionally asking
+           for it to be valid for a specific amount of time (i.e. 24h).
+
+    creds path [key=value ...]
+           Fetch dynamic credentials (i.e. from database/creds/role), and
+           print them along with their lease, as YAML comments.  Any
+           key=value parameters are sent along with the request.
+
+    lease renew lease-id [increment]
+    lease revoke lease-id [lease-id ...]
+    lease revoke-prefix prefix
+    lease lookup lease-id
+           Renew, revoke or look up the leases of dynamic credentials.
+           'revoke-prefix' revokes all of the leases under a path at once,
+           i.e. database/creds/readonly.
+
+    token create [--policy p,...] [--ttl 1h] [--explicit-max-ttl 720h]
+                 [--period 24h] [--orphan] [--use-limit N] [--renewable
+                 true|false] [--display-name name] [--role name]
+                 [--store path]
+           Create a new token, as a child of yours (unless --orphan, or
+           the --role says otherwise).  With --store, the token and its
+           accessor are stored at path, instead of printed (if they can't
+           be, the token is revoked again).
+
+    token lookup [--accessor] token|accessor
+    token revoke [--accessor] token|accessor [...]
+           Look up or revoke another token (and its children), either by
+           the token itself, or (with --accessor) by its accessor.
+
+    token roles
+    token role get name
+    token role set [--allowed-policy p,...] [--disallowed-policy p,...]
+                   [--orphan] [--renewable true|false] [--period 24h]
+                   [--explicit-max-ttl 720h] name
+    token role delete name
+           Manage the roles that tokens can be created against.  'set'
+           replaces the whole role, so give it every setting you want.
+
+    can path [path ...]
+           Show what your token can do (i.e. read, update, delete) with
+           each of the given secrets.
+
+    get [--meta] path [path ...]
+           Retrieve and print the values of one or more paths.  On versioned
+           (KV v2) mounts, a specific version can be retrieved by appending
+           '@' and the version number, i.e. secret/x@3 or secret/x:key@3.
+           With --meta, any custom metadata is printed as YAML comments.
+
+    meta get path
+    meta set path key=value [key=value ...]
+    meta unset path key [key ...]
+           Show, set or remove custom metadata (i.e. an owner, or a ticket
+           number) recorded alongside a secret on a versioned (KV v2) mount.
+
+    versions path
+           List all versions of a secret on a versioned (KV v2) mount, along
+           with when each was created, deleted or destroyed.
+
+    rollback path version
+           Write an older version of a secret on a versioned (KV v2) mount
+           back to the same path, as the newest version.
 
     set path key[=value] [key ...]
            Update a single path with new keys.  Any existing keys that are
            not specified on the command line are left intact. You will be
            prompted to enter values for any keys that do not have values.
            This can be used for more sensitive credentials like passwords,
-           PINs, etc.
+           PINs, etc.  Use key:=value to store a JSON value (i.e. a number,
+           boolean, list or object) instead of a string.
 
     paste path key[=value] [key ...]
            Works the same way as 'safe set', except that it does not
@@ -91,14 +343,35 @@ func main() {
            pasting in data from an external source, and do not expect to
            mis-paste the data, to save a little time + headache.
 
-    paths path [path ... ]
+    paths [--meta] path [path ... ]
            Provide a flat listing of all reachable keys for each path.
 
-    tree path [path ...]
+    tree [--meta] path [path ...]
            Provide a tree hierarchy listing of all reachable keys for each path.
-
-    delete path [path ...]
-           Remove multiple paths from the Vault.
+           With --meta, both paths and tree show the custom metadata of each
+           secret, alongside it.
+
+    delete [--destroy] path [path ...]
+           Remove multiple paths from the Vault.  On versioned (KV v2)
+           mounts, only the latest version is deleted, unless --destroy
+           is given, in which case all versions and metadata are permanently
+           removed (after asking for confirmation, unless -f is given).
+           Use -R to delete entire subtrees.
+
+           Recursive deletes, moves and copies (-R) first check that your
+           token can do what they need to with every secret involved, and
+           refuse to start if it can't, listing the secrets in question.
+           They then ask for confirmation before starting.  -f (--force)
+           skips both the check and the confirmation.
+
+    undelete path [--versions 1,2,...]
+           Restore deleted versions of a secret on a versioned (KV v2) mount.
+           Defaults to the latest version.
+
+    destroy path [--versions 1,2,...|--all]
+           Permanently destroy versions of a secret on a versioned (KV v2)
+           mount (defaults to the latest version).  With --all, every version
+           and all metadata of the secret is removed.
 
     move oldpath newpath
            Move a secret from oldpath to newpath, a rename of sorts.
@@ -106,6 +379,17 @@ func main() {
     copy oldpath newpath
            Copy a secret from oldpath to newpath.
 
+    wrap [--ttl 1h] path[:key]
+           Wrap a secret (or a single key of it) up in a single-use token,
+           which expires after the given TTL (default 1h), and print the
+           token.  Hand the token to whoever needs the secret, instead of
+           the secret itself.
+
+    unwrap [--to path] token
+           Retrieve the secret inside a wrapping token (see 'safe wrap'),
+           printing it just like 'safe get' would, or storing it at the
+           given path.  Each token can only be unwrapped once.
+
     fmt format_type path oldkey newkey
            Take the value found at path:oldkey, and reformat it based
            on the provided flags (such as base64 encoding or crypt
@@ -156,6 +440,9 @@ func main() {
            Vaults PKI backend. If path is supplied, sets the "crl-pem" key using the
            current CRL inside the secret backend, at <path>.
 
+           cert, revoke, ca-pem and crl-pem all use the PKI backend mounted
+           at pki/, unless given another with --backend.
+
     dhparam [bits] path
            Generates DH Params using OpenSSL, and the specified bit length. Defaults
            to 2048 bit primes. Primes are then stored in <path> under the 'dhparam-pem'
@@ -174,6 +461,41 @@ func main() {
 
     vault  ...
            Runs arbitrary commands through the vault cli.
+
+    Global options:
+
+    -k, --insecure
+           Disable SSL/TLS certificate validation.
+
+    --concurrency N
+           Make up to N requests to the Vault at once when walking, exporting,
+           copying, moving or deleting entire trees of secrets (default 8).
+           Can also be set via $SAFE_CONCURRENCY.
+
+    --cas
+           Fail if a secret is modified by someone else while a command (like
+           set, gen or ssh) is updating it, instead of re-reading the secret
+           and trying again.  Can also be set via $SAFE_CAS.
+
+    --timeout DURATION
+           Give up on any single request to the Vault that takes longer than
+           DURATION (i.e. 30s or 2m; default 60s).  Use 0 to wait forever.
+           Can also be set via $VAULT_CLIENT_TIMEOUT.
+
+    Before running a command, safe warns if your token expires within the
+    next hour (or $SAFE_TOKEN_WARN; 0 to turn this off).  Set
+    $SAFE_TOKEN_RENEW to have safe renew the token instead, if it can.
+
+    Pressing Ctrl-C abandons any requests in flight; commands that work on
+    entire trees of secrets then list which paths they did and did not get to.
+
+    Exit codes:
+
+    0      Success (or the operation was declined at a confirmation prompt).
+    1      Any failure not listed below.
+    3      The Vault denied permission (403); check your token's policies.
+    4      There was nothing at the requested path (404).
+    5      The Vault is sealed, or otherwise unavailable (503).
 `)
 		os.Exit(0)
 		return nil
@@ -185,11 +507,14 @@ func main() {
 		}
 
 		cfg := rc.Apply()
-		wide := 0
-		for name := range cfg.Aliases {
+		wide, wideURL := 0, 0
+		for name, url := range cfg.Aliases {
 			if len(name) > wide {
 				wide = len(name)
 			}
+			if len(url) > wideURL {
+				wideURL = len(url)
+			}
 		}
 
 		var keys []string
@@ -198,14 +523,18 @@ func main() {
 		}
 
 		fmt.Fprintf(os.Stderr, "\n")
-		current := fmt.Sprintf("(*) @G{%%-%ds}\t@Y{%%s}\n", wide)
-		other := fmt.Sprintf("    %%-%ds\t%%s\n", wide)
+		current := fmt.Sprintf("(*) @G{%%-%ds}\t@Y{%%-%ds}\t@C{%%s}\n", wide, wideURL)
+		other := fmt.Sprintf("    %%-%ds\t%%-%ds\t%%s\n", wide, wideURL)
 		sort.Strings(keys)
 		for _, name := range keys {
+			ns := ""
+			if t := cfg.Target(name); t != nil {
+				ns = t.Namespace
+			}
 			if name == cfg.Current {
-				ansi.Fprintf(os.Stderr, current, name, cfg.Aliases[name])
+				ansi.Fprintf(os.Stderr, current, name, cfg.Aliases[name], ns)
 			} else {
-				ansi.Fprintf(os.Stderr, other, name, cfg.Aliases[name])
+				ansi.Fprintf(os.Stderr, other, name, cfg.Aliases[name], ns)
 			}
 		}
 		fmt.Fprintf(os.Stderr, "\n")
@@ -214,24 +543,50 @@ func main() {
 
 	r.Dispatch("target", func(command string, args ...string) error {
 		cfg := rc.Apply()
-		if len(args) == 0 {
-			if cfg.Current == "" {
-				ansi.Fprintf(os.Stderr, "@R{No Vault currently targeted}\n")
+
+		namespace := getopt.StringLong("namespace", 'n', "", "Vault Enterprise namespace to use for this target")
+		tlsOpts := map[string]*string{
+			"ca-cert":         getopt.StringLong("ca-cert", 0, "", "PEM-encoded CA certificate(s) to trust for this target"),
+			"ca-path":         getopt.StringLong("ca-path", 0, "", "Directory of PEM-encoded CA certificates to trust for this target"),
+			"client-cert":     getopt.StringLong("client-cert", 0, "", "PEM-encoded client certificate to present to this target"),
+			"client-key":      getopt.StringLong("client-key", 0, "", "Private key for the --client-cert"),
+			"tls-server-name": getopt.StringLong("tls-server-name", 0, "", "Name to expect on this target's TLS certificate"),
+		}
+		args = parseOptions(command, args...)
+		setNamespace := getopt.Lookup("namespace").Seen()
+		setTLS := false
+		for name := range tlsOpts {
+			if getopt.Lookup(name).Seen() {
+				setTLS = true
+			}
+		}
+
+		targeting := func(verb string) {
+			if ns := cfg.Namespace(); ns != "" {
+				ansi.Fprintf(os.Stderr, "%s @C{%s} at @C{%s} in namespace @C{%s}\n", verb, cfg.Current, cfg.URL(), ns)
 			} else {
-				ansi.Fprintf(os.Stderr, "Currently targeting @C{%s} at @C{%s}\n", cfg.Current, cfg.URL())
+				ansi.Fprintf(os.Stderr, "%s @C{%s} at @C{%s}\n", verb, cfg.Current, cfg.URL())
 			}
-			return nil
 		}
-		if len(args) == 1 {
+
+		switch len(args) {
+		case 0:
+			if cfg.Current == "" {
+				ansi.Fprintf(os.Stderr, "@R{No Vault currently targeted}\n")
+				return nil
+			}
+			if !setNamespace && !setTLS {
+				targeting("Currently targeting")
+				return nil
+			}
+
+		case 1:
 			err := cfg.SetCurrent(args[0])
 			if err != nil {
 				return err
 			}
-			ansi.Fprintf(os.Stderr, "Now targeting @C{%s} at @C{%s}\n", cfg.Current, cfg.URL())
-			return cfg.Write()
-		}
 
-		if len(args) == 2 {
+		case 2:
 			var err error
 			if strings.HasPrefix(args[1], "http://") || strings.HasPrefix(args[1], "https://") {
 				err = cfg.SetTarget(args[0], args[1])
@@ -241,131 +596,1589 @@ func main() {
 			if err != nil {
 				return err
 			}
-			ansi.Fprintf(os.Stderr, "Now targeting @C{%s} at @C{%s}\n", cfg.Current, cfg.URL())
-			return cfg.Write()
+
+		default:
+			return fmt.Errorf("USAGE: target [--namespace ns] [--ca-cert file] [--ca-path dir] [--client-cert file --client-key file] [--tls-server-name name] [vault-address] name")
 		}
 
-		return fmt.Errorf("USAGE: target [vault-address] name")
+		if setNamespace {
+			if err := cfg.SetNamespace(*namespace); err != nil {
+				return err
+			}
+		}
+		if setTLS {
+			var tls rc.TLS
+			if t := cfg.Target(cfg.Current); t != nil {
+				tls = t.TLS
+			}
+			/* files are stored with absolute paths, so that the target
+			   works no matter which directory safe is run from */
+			file := func(name string, into *string) error {
+				if !getopt.Lookup(name).Seen() {
+					return nil
+				}
+				*into = *tlsOpts[name]
+				if *into == "" {
+					return nil
+				}
+				abs, err := filepath.Abs(*into)
+				if err != nil {
+					return err
+				}
+				*into = abs
+				return nil
+			}
+			for name, into := range map[string]*string{
+				"ca-cert":     &tls.CACert,
+				"ca-path":     &tls.CAPath,
+				"client-cert": &tls.ClientCert,
+				"client-key":  &tls.ClientKey,
+			} {
+				if err := file(name, into); err != nil {
+					return err
+				}
+			}
+			if getopt.Lookup("tls-server-name").Seen() {
+				tls.ServerName = *tlsOpts["tls-server-name"]
+			}
+			if (tls.ClientCert == "") != (tls.ClientKey == "") {
+				return fmt.Errorf("both --client-cert and --client-key must be given to use a client certificate")
+			}
+			if err := cfg.SetTLS(tls); err != nil {
+				return err
+			}
+		}
+		targeting("Now targeting")
+		return cfg.Write()
 	})
 
-	r.Dispatch("env", func(command string, args ...string) error {
-		rc.Apply()
-		ansi.Fprintf(os.Stderr, "  @B{VAULT_ADDR}  @G{%s}\n", os.Getenv("VAULT_ADDR"))
-		ansi.Fprintf(os.Stderr, "  @B{VAULT_TOKEN} @G{%s}\n", os.Getenv("VAULT_TOKEN"))
+	r.Dispatch("status", func(command string, args ...string) error {
+		cfg := rc.Apply()
+		all := getopt.BoolLong("all", 'a', "Show the status of every Vault that has been targeted")
+		args = parseOptions(command, args...)
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: status [--all]")
+		}
+
+		if !*all {
+			v := dial(false)
+			ansi.Printf("@C{%s}\n", v.URL)
+			return printStatus(v)
+		}
+
+		var names []string
+		for name := range cfg.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			url := cfg.Aliases[name]
+			if name == cfg.Current {
+				ansi.Printf("(*) @G{%s}\t@C{%s}\n", name, url)
+			} else {
+				ansi.Printf("    %s\t@C{%s}\n", name, url)
+			}
+
+			err := cfg.WithTarget(url, func() {
+				v, err := vault.NewUnauthenticatedVault(url)
+				if err == nil {
+					err = printStatus(v)
+				}
+				if err != nil {
+					ansi.Printf("      @R{!! %s}\n", err)
+				}
+			})
+			if err != nil {
+				ansi.Printf("      @R{!! %s}\n", err)
+			}
+			fmt.Printf("\n")
+		}
 		return nil
 	})
 
-	r.Dispatch("auth", func(command string, args ...string) error {
+	r.Dispatch("init", func(command string, args ...string) error {
 		cfg := rc.Apply()
+		shares := getopt.IntLong("shares", 0, 5, "Number of unseal keys to split the master key into")
+		threshold := getopt.IntLong("threshold", 0, 3, "Number of unseal keys needed to unseal the Vault")
+		sealed := getopt.BoolLong("sealed", 0, "Leave the Vault sealed after initializing it")
+		persist := getopt.StringLong("persist", 0, "", "Also store the unseal keys and root token in the Vault, at this path")
+		args = parseOptions(command, args...)
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: init [--shares 5] [--threshold 3] [--sealed] [--persist path]")
+		}
+		if *threshold < 1 || *threshold > *shares {
+			return fmt.Errorf("--threshold must be between 1 and the number of --shares (%d)", *shares)
+		}
+		if *sealed && *persist != "" {
+			return fmt.Errorf("cannot --persist the unseal keys into a Vault that is left --sealed")
+		}
 
-		method := "token"
-		if len(args) > 0 {
-			method = args[0]
-			args = args[1:]
+		v := dial(false)
+		initialized, err := v.Initialized(ctx)
+		if err != nil {
+			return err
+		}
+		if initialized {
+			return fmt.Errorf("%s has already been initialized", v.URL)
 		}
 
-		var token string
-		var err error
+		keys, err := v.Init(ctx, *shares, *threshold)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys.Keys {
+			fmt.Printf("Unseal Key #%d: %s\n", i+1, key)
+		}
+		fmt.Printf("Initial Root Token: %s\n", keys.RootToken)
+		ansi.Fprintf(os.Stderr, "\n@G{Initialized %s} with @Y{%d} unseal keys (@Y{%d} needed to unseal it)\n", v.URL, *shares, *threshold)
+		ansi.Fprintf(os.Stderr, "@R{Keep these keys and the root token somewhere safe; they cannot be retrieved again.}\n")
 
-		ansi.Fprintf(os.Stderr, "Authenticating against @C{%s} at @C{%s}\n", cfg.Current, cfg.URL())
-		switch method {
-		case "token":
-			token, err = auth.Token(os.Getenv("VAULT_ADDR"))
-			if err != nil {
+		if cfg.URL() == v.URL {
+			cfg.SetToken(keys.RootToken)
+			if err := cfg.Write(); err != nil {
 				return err
 			}
-			break
+			ansi.Fprintf(os.Stderr, "Now authenticated to @C{%s} with the root token\n", cfg.Current)
+		}
 
-		case "ldap":
-			token, err = auth.LDAP(os.Getenv("VAULT_ADDR"))
+		if *sealed {
+			return nil
+		}
+		var s *vault.SealStatus
+		for _, key := range keys.Keys[:*threshold] {
+			s, err = v.Unseal(ctx, key)
 			if err != nil {
 				return err
 			}
-			break
+			if !s.Sealed {
+				break
+			}
+		}
+		if s == nil || s.Sealed {
+			return fmt.Errorf("%s is still sealed; unseal it with 'safe unseal' and the keys above", v.URL)
+		}
+		ansi.Fprintf(os.Stderr, "@G{Unsealed %s}\n", v.URL)
 
-		case "github":
-			token, err = auth.Github(os.Getenv("VAULT_ADDR"))
-			if err != nil {
-				return err
+		if *persist != "" {
+			s := vault.NewSecret()
+			for i, key := range keys.Keys {
+				s.Set(fmt.Sprintf("key%d", i+1), key)
 			}
-			break
+			s.Set("root_token", keys.RootToken)
 
-		default:
-			return fmt.Errorf("Unrecognized authentication method '%s'", method)
+			v.Token = keys.RootToken
+			if err := v.Write(ctx, *persist, s); err != nil {
+				return fmt.Errorf("unable to store the unseal keys at %s: %s", *persist, err)
+			}
+			ansi.Fprintf(os.Stderr, "Stored the unseal keys and root token at @C{%s}\n", *persist)
 		}
+		return nil
+	})
 
-		cfg.SetToken(token)
-		return cfg.Write()
+	r.Dispatch("unseal", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: unseal")
+		}
 
-	}, "login")
+		v := dial(false)
+		s, err := v.SealStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if !s.Initialized {
+			return fmt.Errorf("%s has not been initialized yet (try safe init)", v.URL)
+		}
+		if !s.Sealed {
+			ansi.Fprintf(os.Stderr, "@G{%s is already unsealed}\n", v.URL)
+			return nil
+		}
 
-	r.Dispatch("set", func(command string, args ...string) error {
+		ansi.Fprintf(os.Stderr, "Unsealing @C{%s}; @Y{%d} of its @Y{%d} unseal keys are needed\n", v.URL, s.Threshold, s.Shares)
+		for s.Sealed {
+			key := prompt.Secure("Unseal key %d of %d: ", s.Progress+1, s.Threshold)
+			if key == "" {
+				return fmt.Errorf("%s is still sealed (%d of %d unseal keys provided)", v.URL, s.Progress, s.Threshold)
+			}
+			if s, err = v.Unseal(ctx, key); err != nil {
+				return err
+			}
+		}
+		ansi.Fprintf(os.Stderr, "@G{Unsealed %s}\n", v.URL)
+		return nil
+	})
+
+	r.Dispatch("seal", func(command string, args ...string) error {
 		rc.Apply()
-		if len(args) < 2 {
-			return fmt.Errorf("USAGE: set path key[=value] [key ...]")
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: seal")
 		}
+
 		v := connect()
-		path, args := args[0], args[1:]
-		s, err := v.Read(path)
-		if err != nil && err != vault.NotFound {
+		if err := v.Seal(ctx); err != nil {
 			return err
 		}
-		for _, set := range args {
-			k, v, err := keyPrompt(set, true)
-			if err != nil {
+		ansi.Fprintf(os.Stderr, "@Y{Sealed %s}\n", v.URL)
+		return nil
+	})
+
+	r.Dispatch("rekey", func(command string, args ...string) error {
+		rc.Apply()
+		shares := getopt.IntLong("shares", 0, 5, "Number of new unseal keys to split the master key into")
+		threshold := getopt.IntLong("threshold", 0, 3, "Number of new unseal keys needed to unseal the Vault")
+		pgp := getopt.ListLong("pgp-key", 0, "", "Comma-separated list of PGP public keys (files, or keybase:user) to encrypt the new unseal keys with")
+		backup := getopt.BoolLong("backup", 0, "Have the Vault keep a backup of the PGP-encrypted unseal keys")
+		args = parseOptions(command, args...)
+
+		action := "update"
+		if len(args) > 0 {
+			action, args = args[0], args[1:]
+		}
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: rekey [init|status|cancel] [--shares 5] [--threshold 3] [--pgp-key file,...] [--backup]")
+		}
+
+		v := dial(false)
+		s, err := v.RekeyStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "status":
+			if !s.Started {
+				ansi.Printf("No rekey in progress\n")
+				return nil
+			}
+			ansi.Printf("Rekey in progress (nonce @C{%s})\n", s.Nonce)
+			ansi.Printf("  @B{new keys}   @G{%d} (@G{%d} needed to unseal)\n", s.Shares, s.Threshold)
+			ansi.Printf("  @B{progress}   @Y{%d} of @Y{%d} current unseal keys provided\n", s.Progress, s.Required)
+			for _, fp := range s.PGPFingerprints {
+				ansi.Printf("  @B{pgp key}    %s\n", fp)
+			}
+			return nil
+
+		case "cancel":
+			if !s.Started {
+				return fmt.Errorf("there is no rekey in progress")
+			}
+			if err := v.CancelRekey(ctx); err != nil {
+				return err
+			}
+			ansi.Fprintf(os.Stderr, "@Y{Cancelled the rekey of %s}\n", v.URL)
+			return nil
+
+		case "init", "update":
+			if s.Started && action == "init" {
+				return fmt.Errorf("a rekey is already in progress (nonce %s); use safe rekey cancel to start over", s.Nonce)
+			}
+			if !s.Started {
+				var keys []string
+				for _, file := range *pgp {
+					key, err := vault.ReadPGPKey(file)
+					if err != nil {
+						return err
+					}
+					keys = append(keys, key)
+				}
+				if len(keys) > 0 && !getopt.Lookup("shares").Seen() {
+					*shares = len(keys)
+					if *threshold > *shares && !getopt.Lookup("threshold").Seen() {
+						*threshold = *shares
+					}
+				}
+				if len(keys) > 0 && len(keys) != *shares {
+					return fmt.Errorf("%d PGP keys given, for %d new unseal keys; there must be one per key", len(keys), *shares)
+				}
+				if *backup && len(keys) == 0 {
+					return fmt.Errorf("--backup only works with PGP-encrypted keys (see --pgp-key)")
+				}
+				if *threshold < 1 || *threshold > *shares {
+					return fmt.Errorf("--threshold must be between 1 and the number of --shares (%d)", *shares)
+				}
+
+				s, err = v.StartRekey(ctx, *shares, *threshold, keys, *backup)
+				if err != nil {
+					return err
+				}
+				ansi.Fprintf(os.Stderr, "Started rekeying @C{%s} (nonce @C{%s})\n", v.URL, s.Nonce)
+				if action == "init" {
+					return nil
+				}
+			}
+
+			nonce := s.Nonce
+			ansi.Fprintf(os.Stderr, "Rekeying @C{%s} (nonce @C{%s}) into @Y{%d} new unseal keys\n", v.URL, nonce, s.Shares)
+			done, err := promptKeys(s.Progress, s.Required, func(key string) (int, bool, error) {
+				s, err = v.RekeyUpdate(ctx, key, nonce)
+				if err != nil {
+					return 0, false, err
+				}
+				return s.Progress, s.Complete, nil
+			})
+			if err != nil || !done {
 				return err
 			}
-			s.Set(k, v)
+
+			for i, key := range s.Keys {
+				fmt.Printf("Unseal Key #%d: %s\n", i+1, key)
+				if i < len(s.PGPFingerprints) {
+					fmt.Printf("  (encrypted for %s)\n", s.PGPFingerprints[i])
+				}
+			}
+			ansi.Fprintf(os.Stderr, "\n@G{Rekeyed %s}; the old unseal keys no longer work\n", v.URL)
+			return nil
 		}
-		return v.Write(path, s)
-	}, "write")
+		return fmt.Errorf("USAGE: rekey [init|status|cancel] [--shares 5] [--threshold 3] [--pgp-key file,...] [--backup]")
+	})
 
-	r.Dispatch("paste", func(command string, args ...string) error {
+	r.Dispatch("generate-root", func(command string, args ...string) error {
 		rc.Apply()
-		if len(args) < 2 {
-			return fmt.Errorf("USAGE: paste path key[=value] [key ...]")
+		pgp := getopt.StringLong("pgp-key", 0, "", "PGP public key (file, or keybase:user) to encrypt the new root token with")
+		otp := getopt.StringLong("otp", 0, "", "One-time password to decode the new root token with")
+		args = parseOptions(command, args...)
+
+		action := "update"
+		if len(args) > 0 {
+			action, args = args[0], args[1:]
 		}
-		v := connect()
-		path, args := args[0], args[1:]
-		s, err := v.Read(path)
-		if err != nil && err != vault.NotFound {
+		if action == "decode" {
+			if len(args) != 1 || *otp == "" {
+				return fmt.Errorf("USAGE: generate-root decode --otp password encoded-token")
+			}
+			/* how the token was encoded depends on the Vault */
+			s, err := dial(false).GenerateRootStatus(ctx)
+			if err != nil {
+				return err
+			}
+			token, err := vault.DecodeRootToken(args[0], *otp, s.Legacy())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Root Token: %s\n", token)
+			return nil
+		}
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: generate-root [init|status|cancel|decode] [--pgp-key file] [--otp password]")
+		}
+
+		v := dial(false)
+		s, err := v.GenerateRootStatus(ctx)
+		if err != nil {
 			return err
 		}
-		for _, set := range args {
-			k, v, err := keyPrompt(set, false)
-			if err != nil {
+		legacy := s.Legacy()
+
+		switch action {
+		case "status":
+			if !s.Started {
+				ansi.Printf("No root token generation in progress\n")
+				return nil
+			}
+			ansi.Printf("Root token generation in progress (nonce @C{%s})\n", s.Nonce)
+			ansi.Printf("  @B{progress}   @Y{%d} of @Y{%d} unseal keys provided\n", s.Progress, s.Required)
+			if s.PGPFingerprint != "" {
+				ansi.Printf("  @B{pgp key}    %s\n", s.PGPFingerprint)
+			}
+			return nil
+
+		case "cancel":
+			if !s.Started {
+				return fmt.Errorf("there is no root token generation in progress")
+			}
+			if err := v.CancelGenerateRoot(ctx); err != nil {
+				return err
+			}
+			ansi.Fprintf(os.Stderr, "@Y{Cancelled the root token generation for %s}\n", v.URL)
+			return nil
+
+		case "init", "update":
+			if s.Started && action == "init" {
+				return fmt.Errorf("a root token generation is already in progress (nonce %s); use safe generate-root cancel to start over", s.Nonce)
+			}
+			if !s.Started {
+				var key string
+				if *pgp != "" {
+					if key, err = vault.ReadPGPKey(*pgp); err != nil {
+						return err
+					}
+					*otp = ""
+				} else if legacy && *otp == "" {
+					if *otp, err = vault.NewOTP(); err != nil {
+						return err
+					}
+				} else if !legacy {
+					*otp = ""
+				}
+
+				s, err = v.StartGenerateRoot(ctx, *otp, key)
+				if err != nil {
+					return err
+				}
+				if s.OTP != "" {
+					*otp = s.OTP
+				}
+				ansi.Fprintf(os.Stderr, "Started generating a new root token for @C{%s} (nonce @C{%s})\n", v.URL, s.Nonce)
+				if *otp != "" {
+					ansi.Fprintf(os.Stderr, "One-time password: @G{%s}\n", *otp)
+					ansi.Fprintf(os.Stderr, "@Y{Keep this password; it is needed to decode the new root token}\n")
+				}
+				if action == "init" {
+					return nil
+				}
+			}
+
+			nonce := s.Nonce
+			ansi.Fprintf(os.Stderr, "Generating a new root token for @C{%s} (nonce @C{%s})\n", v.URL, nonce)
+			done, err := promptKeys(s.Progress, s.Required, func(key string) (int, bool, error) {
+				s, err = v.GenerateRootUpdate(ctx, key, nonce)
+				if err != nil {
+					return 0, false, err
+				}
+				return s.Progress, s.Complete, nil
+			})
+			if err != nil || !done {
 				return err
 			}
-			s.Set(k, v)
+
+			switch {
+			case s.PGPFingerprint != "":
+				fmt.Printf("Encrypted Root Token: %s\n", s.Token())
+				ansi.Fprintf(os.Stderr, "\nThe root token is encrypted for @C{%s}; decrypt it with @C{base64 -d | gpg -d}\n", s.PGPFingerprint)
+			case *otp != "":
+				token, err := vault.DecodeRootToken(s.Token(), *otp, legacy)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Root Token: %s\n", token)
+			default:
+				fmt.Printf("Encoded Root Token: %s\n", s.Token())
+				ansi.Fprintf(os.Stderr, "\nDecode it with the one-time password this root token generation was started with:\n")
+				ansi.Fprintf(os.Stderr, "  @C{safe generate-root decode --otp <password> %s}\n", s.Token())
+			}
+			return nil
+		}
+		return fmt.Errorf("USAGE: generate-root [init|status|cancel|decode] [--pgp-key file] [--otp password]")
+	})
+
+	r.Dispatch("mounts", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: mounts")
+		}
+
+		v := connect()
+		mounts, err := v.Mounts(ctx)
+		if err != nil {
+			return err
+		}
+
+		wide, wideType := 0, 0
+		for _, m := range mounts {
+			if len(m.Path) > wide {
+				wide = len(m.Path)
+			}
+			if len(m.Type) > wideType {
+				wideType = len(m.Type)
+			}
+		}
+		for _, m := range mounts {
+			version := ""
+			if m.Version > 0 {
+				version = fmt.Sprintf("v%d", m.Version)
+			}
+			ansi.Printf(fmt.Sprintf("@C{%%-%ds}  @G{%%-%ds}  %%-2s  %%s\n", wide, wideType), m.Path, m.Type, version, m.Description)
+		}
+		return nil
+	})
+
+	r.Dispatch("mount", func(command string, args ...string) error {
+		rc.Apply()
+		config := mountOptions()
+		args = parseOptions(command, args...)
+		if len(args) != 2 {
+			return fmt.Errorf("USAGE: mount [--kv-version 2] [--description text] [--default-lease-ttl ttl] [--max-lease-ttl ttl] type path")
+		}
+
+		c, err := config()
+		if err != nil {
+			return err
+		}
+		typ, path := args[0], args[1]
+		if c.Options["version"] != "" && typ != "kv" {
+			return fmt.Errorf("--kv-version only applies to kv mounts")
+		}
+
+		v := connect()
+		if err := v.Mount(ctx, typ, path, c); err != nil {
+			return err
+		}
+		ansi.Fprintf(os.Stderr, "Mounted a new @G{%s} secrets engine at @C{%s/}\n", typ, strings.Trim(path, "/"))
+		return nil
+	})
+
+	r.Dispatch("unmount", func(command string, args ...string) error {
+		rc.Apply()
+		force := getopt.BoolLong("force", 'f', "Disable confirmation prompting")
+		args = parseOptions(command, args...)
+		if len(args) != 1 {
+			return fmt.Errorf("USAGE: unmount [-f] path")
+		}
+
+		if !*force {
+			confirm("Are you sure you wish to unmount %s and delete all of its secrets?", args[0])
+		}
+		v := connect()
+		if err := v.Unmount(ctx, args[0]); err != nil {
+			return err
+		}
+		ansi.Fprintf(os.Stderr, "Unmounted @C{%s/}\n", strings.Trim(args[0], "/"))
+		return nil
+	})
+
+	r.Dispatch("tune", func(command string, args ...string) error {
+		rc.Apply()
+		config := mountOptions()
+		args = parseOptions(command, args...)
+		if len(args) != 1 {
+			return fmt.Errorf("USAGE: tune [--kv-version 2] [--description text] [--default-lease-ttl ttl] [--max-lease-ttl ttl] path")
+		}
+
+		c, err := config()
+		if err != nil {
+			return err
+		}
+		v := connect()
+		return v.Tune(ctx, args[0], c)
+	})
+
+	r.Dispatch("remount", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) != 2 {
+			return fmt.Errorf("USAGE: remount oldpath newpath")
+		}
+
+		v := connect()
+		if err := v.Remount(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		ansi.Fprintf(os.Stderr, "Moved @C{%s/} to @C{%s/}\n", strings.Trim(args[0], "/"), strings.Trim(args[1], "/"))
+		return nil
+	})
+
+	r.Dispatch("policy", func(command string, args ...string) error {
+		rc.Apply()
+		prune := getopt.BoolLong("prune", 0, "Delete policies that are not in the directory being applied")
+		dryRun := getopt.BoolLong("dry-run", 'n', "Show what would change, without changing anything")
+		args = parseOptions(command, args...)
+		if len(args) < 1 {
+			return fmt.Errorf("USAGE: policy list|get|set|delete|apply [name|dir]")
+		}
+		sub, args := args[0], args[1:]
+
+		v := connect()
+		switch sub {
+		case "list", "ls":
+			if len(args) != 0 {
+				return fmt.Errorf("USAGE: policy list")
+			}
+			names, err := v.Policies(ctx)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				fmt.Printf("%s\n", name)
+			}
+			return nil
+
+		case "get":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: policy get name")
+			}
+			rules, err := v.Policy(ctx, args[0])
+			if err == vault.NotFound {
+				return fmt.Errorf("no such policy '%s'", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", strings.TrimRight(rules, "\n"))
+			return nil
+
+		case "set":
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("USAGE: policy set name [file]")
+			}
+			var b []byte
+			var err error
+			if len(args) == 1 || args[1] == "-" {
+				b, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				b, err = ioutil.ReadFile(args[1])
+			}
+			if err != nil {
+				return err
+			}
+			return v.SetPolicy(ctx, args[0], string(b))
+
+		case "delete", "rm":
+			if len(args) < 1 {
+				return fmt.Errorf("USAGE: policy delete name [name ...]")
+			}
+			for _, name := range args {
+				if err := v.DeletePolicy(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+
+		case "apply":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: policy apply [--prune] [--dry-run] dir")
+			}
+			return applyPolicies(v, args[0], *prune, *dryRun)
+		}
+		return fmt.Errorf("USAGE: policy list|get|set|delete|apply [name|dir]")
+	})
+
+	r.Dispatch("transit", func(command string, args ...string) error {
+		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "transit", "Path that the transit backend is mounted at")
+		typ := getopt.StringLong("type", 0, "", "Type of key to create (i.e. aes256-gcm96, or rsa-4096)")
+		minDecrypt := getopt.IntLong("min-decryption-version", 0, 0, "Oldest version of the key that can still decrypt")
+		minEncrypt := getopt.IntLong("min-encryption-version", 0, 0, "Oldest version of the key that can be used to encrypt")
+		deletable := getopt.StringLong("deletion-allowed", 0, "", "Whether or not the key can be deleted (true or false)")
+		exportable := getopt.BoolLong("exportable", 0, "Allow the key to be exported (this cannot be undone)")
+		args = parseOptions(command, args...)
+		if len(args) < 1 {
+			return fmt.Errorf("USAGE: transit keys|create|rotate|config [name]")
+		}
+		sub, args := args[0], args[1:]
+
+		v := connect()
+		switch sub {
+		case "keys":
+			if len(args) > 1 {
+				return fmt.Errorf("USAGE: transit keys [name]")
+			}
+			if len(args) == 0 {
+				keys, err := v.TransitKeys(ctx, *backend)
+				if err != nil {
+					return err
+				}
+				for _, key := range keys {
+					fmt.Printf("%s\n", key)
+				}
+				return nil
+			}
+
+			key, err := v.TransitKey(ctx, *backend, args[0])
+			if err == vault.NotFound {
+				return fmt.Errorf("no such transit key '%s'", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			ansi.Printf("  @B{name}                    @G{%s}\n", key.Name)
+			ansi.Printf("  @B{type}                    @G{%s}\n", key.Type)
+			ansi.Printf("  @B{latest version}          @G{%d}\n", key.LatestVersion)
+			ansi.Printf("  @B{min decryption version}  @G{%d}\n", key.MinDecryptionVersion)
+			ansi.Printf("  @B{min encryption version}  @G{%d}\n", key.MinEncryptionVersion)
+			ansi.Printf("  @B{deletion allowed}        @G{%t}\n", key.DeletionAllowed)
+			ansi.Printf("  @B{exportable}              @G{%t}\n", key.Exportable)
+			return nil
+
+		case "create":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: transit create [--type aes256-gcm96] name")
+			}
+			return v.CreateTransitKey(ctx, *backend, args[0], *typ)
+
+		case "rotate":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: transit rotate name")
+			}
+			if err := v.RotateTransitKey(ctx, *backend, args[0]); err != nil {
+				return err
+			}
+			key, err := v.TransitKey(ctx, *backend, args[0])
+			if err != nil {
+				return err
+			}
+			ansi.Fprintf(os.Stderr, "Rotated @C{%s}; it is now at version @G{%d}\n", args[0], key.LatestVersion)
+			return nil
+
+		case "config":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: transit config [--min-decryption-version N] [--min-encryption-version N] [--deletion-allowed true|false] [--exportable] name")
+			}
+			var c vault.TransitKeyConfig
+			if getopt.Lookup("min-decryption-version").Seen() {
+				c.MinDecryptionVersion = minDecrypt
+			}
+			if getopt.Lookup("min-encryption-version").Seen() {
+				c.MinEncryptionVersion = minEncrypt
+			}
+			if *deletable != "" {
+				b, err := strconv.ParseBool(*deletable)
+				if err != nil {
+					return fmt.Errorf("invalid --deletion-allowed '%s' (must be true or false)", *deletable)
+				}
+				c.DeletionAllowed = &b
+			}
+			if *exportable {
+				c.Exportable = exportable
+			}
+			return v.ConfigureTransitKey(ctx, *backend, args[0], c)
+		}
+		return fmt.Errorf("USAGE: transit keys|create|rotate|config [name]")
+	})
+
+	r.Dispatch("encrypt", func(command string, args ...string) error {
+		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "transit", "Path that the transit backend is mounted at")
+		version := getopt.IntLong("key-version", 0, 0, "Version of the key to encrypt with (defaults to the latest)")
+		batch := getopt.BoolLong("batch", 0, "Encrypt each line of the input separately")
+		args = parseOptions(command, args...)
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("USAGE: encrypt [--batch] [--key-version N] key [file|-]")
+		}
+
+		in, err := readInput(args[1:])
+		if err != nil {
+			return err
+		}
+		plaintexts := [][]byte{in}
+		if *batch {
+			plaintexts = nil
+			for _, line := range strings.Split(strings.TrimRight(string(in), "\n"), "\n") {
+				plaintexts = append(plaintexts, []byte(line))
+			}
+		}
+
+		v := connect()
+		ciphertexts, err := v.Encrypt(ctx, *backend, args[0], plaintexts, *version)
+		if err != nil {
+			return err
+		}
+		for _, c := range ciphertexts {
+			fmt.Printf("%s\n", c)
+		}
+		return nil
+	})
+
+	r.Dispatch("decrypt", func(command string, args ...string) error {
+		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "transit", "Path that the transit backend is mounted at")
+		batch := getopt.BoolLong("batch", 0, "Decrypt each line of the input separately")
+		args = parseOptions(command, args...)
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("USAGE: decrypt [--batch] key [file|-]")
+		}
+
+		in, err := readInput(args[1:])
+		if err != nil {
+			return err
+		}
+		ciphertexts := strings.Fields(string(in))
+		if !*batch && len(ciphertexts) != 1 {
+			return fmt.Errorf("expected a single ciphertext, but found %d (use --batch to decrypt one per line)", len(ciphertexts))
+		}
+
+		v := connect()
+		plaintexts, err := v.Decrypt(ctx, *backend, args[0], ciphertexts)
+		if err != nil {
+			return err
+		}
+		for _, p := range plaintexts {
+			os.Stdout.Write(p)
+			if *batch {
+				fmt.Printf("\n")
+			}
+		}
+		return nil
+	})
+
+	r.Dispatch("rewrap", func(command string, args ...string) error {
+		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "transit", "Path that the transit backend is mounted at")
+		version := getopt.IntLong("key-version", 0, 0, "Version of the key to re-encrypt with (defaults to the latest)")
+		args = parseOptions(command, args...)
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("USAGE: rewrap [--key-version N] key [file|-]")
+		}
+
+		in, err := readInput(args[1:])
+		if err != nil {
+			return err
+		}
+
+		v := connect()
+		ciphertexts, err := v.Rewrap(ctx, *backend, args[0], strings.Fields(string(in)), *version)
+		if err != nil {
+			return err
+		}
+		for _, c := range ciphertexts {
+			fmt.Printf("%s\n", c)
+		}
+		return nil
+	})
+
+	r.Dispatch("seal-file", func(command string, args ...string) error {
+		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "transit", "Path that the transit backend is mounted at")
+		values := getopt.BoolLong("values", 0, "Only seal the values of a YAML or JSON document, leaving its keys readable")
+		args = parseOptions(command, args...)
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("USAGE: seal-file [--values] key [file|-]")
+		}
+
+		in, err := readInput(args[1:])
+		if err != nil {
+			return err
+		}
+
+		v := connect()
+		var out []byte
+		if *values {
+			out, err = v.SealValues(ctx, *backend, args[0], in)
+		} else {
+			out, err = v.SealFile(ctx, *backend, args[0], in)
+		}
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+		return nil
+	})
+
+	r.Dispatch("unseal-file", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) > 1 {
+			return fmt.Errorf("USAGE: unseal-file [file|-]")
+		}
+
+		in, err := readInput(args)
+		if err != nil {
+			return err
+		}
+
+		v := connect()
+		var out []byte
+		if vault.IsSealedFile(in) {
+			out, err = v.UnsealFile(ctx, in)
+		} else {
+			out, err = v.UnsealValues(ctx, in)
+		}
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+		return nil
+	})
+
+	r.Dispatch("whoami", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: whoami")
+		}
+
+		v := dial(true)
+		info, err := v.LookupSelf(ctx)
+		if err != nil {
+			return err
+		}
+
+		expires := "never"
+		if info.TTL > 0 {
+			expires = fmt.Sprintf("in %s (%s)", info.TTL, time.Now().Add(info.TTL).Format("2006-01-02 15:04:05"))
+		}
+		ansi.Printf("  @B{name}       @G{%s}\n", info.DisplayName)
+		ansi.Printf("  @B{policies}   @G{%s}\n", strings.Join(info.Policies, ", "))
+		ansi.Printf("  @B{expires}    @G{%s}\n", expires)
+		ansi.Printf("  @B{renewable}  @G{%t}\n", info.Renewable)
+		return nil
+	})
+
+	r.Dispatch("renew", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) > 1 {
+			return fmt.Errorf("USAGE: renew [increment]")
+		}
+
+		var increment time.Duration
+		if len(args) == 1 {
+			d, err := time.ParseDuration(args[0])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid increment '%s' (try something like 1h or 30m)", args[0])
+			}
+			increment = d
+		}
+
+		v := dial(true)
+		ttl, err := v.RenewSelf(ctx, increment)
+		if err != nil {
+			return err
+		}
+		if ttl == 0 {
+			ansi.Fprintf(os.Stderr, "Renewed your Vault token; it never expires\n")
+		} else {
+			ansi.Fprintf(os.Stderr, "Renewed your Vault token; it is now valid for @G{%s}\n", ttl)
+		}
+		return nil
+	})
+
+	r.Dispatch("creds", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) < 1 {
+			return fmt.Errorf("USAGE: creds path [key=value ...]")
+		}
+		path, args := args[0], args[1:]
+
+		params := make(map[string]string)
+		for _, arg := range args {
+			l := strings.SplitN(arg, "=", 2)
+			if len(l) != 2 || l[0] == "" {
+				return fmt.Errorf("invalid parameter '%s' (must be key=value)", arg)
+			}
+			params[l[0]] = l[1]
+		}
+
+		v := connect()
+		s, lease, err := v.Creds(ctx, path, params)
+		if err == vault.NotFound {
+			return fmt.Errorf("no credentials at %s", path)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--- # %s\n", path)
+		if lease.ID != "" {
+			fmt.Printf("# lease_id: %s\n", lease.ID)
+			fmt.Printf("# lease_duration: %s\n", lease.Duration)
+			fmt.Printf("# renewable: %t\n", lease.Renewable)
+		}
+		fmt.Printf("%s\n\n", s.YAML())
+		return nil
+	})
+
+	r.Dispatch("lease", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) < 2 {
+			return fmt.Errorf("USAGE: lease renew|revoke|revoke-prefix|lookup lease-id")
+		}
+		sub, args := args[0], args[1:]
+
+		v := connect()
+		switch sub {
+		case "renew":
+			if len(args) > 2 {
+				return fmt.Errorf("USAGE: lease renew lease-id [increment]")
+			}
+			var increment time.Duration
+			if len(args) == 2 {
+				d, err := time.ParseDuration(args[1])
+				if err != nil || d <= 0 {
+					return fmt.Errorf("invalid increment '%s' (try something like 1h or 30m)", args[1])
+				}
+				increment = d
+			}
+			lease, err := v.RenewLease(ctx, args[0], increment)
+			if err != nil {
+				return err
+			}
+			ansi.Fprintf(os.Stderr, "Renewed @C{%s}; it is now valid for @G{%s}\n", args[0], lease.Duration)
+			return nil
+
+		case "revoke":
+			for _, id := range args {
+				if err := v.RevokeLease(ctx, id); err != nil {
+					return err
+				}
+				ansi.Fprintf(os.Stderr, "Revoked @C{%s}\n", id)
+			}
+			return nil
+
+		case "revoke-prefix":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: lease revoke-prefix prefix")
+			}
+			if err := v.RevokeLeasePrefix(ctx, args[0]); err != nil {
+				return err
+			}
+			ansi.Fprintf(os.Stderr, "Revoked every lease under @C{%s}\n", args[0])
+			return nil
+
+		case "lookup":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: lease lookup lease-id")
+			}
+			info, err := v.LookupLease(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			when := func(t time.Time) string {
+				if t.IsZero() {
+					return "never"
+				}
+				return t.Local().Format("2006-01-02 15:04:05")
+			}
+			ansi.Printf("  @B{id}            @G{%s}\n", info.ID)
+			ansi.Printf("  @B{issued}        @G{%s}\n", when(info.IssueTime))
+			ansi.Printf("  @B{last renewed}  @G{%s}\n", when(info.LastRenewal))
+			ansi.Printf("  @B{expires}       @G{%s}\n", when(info.ExpireTime))
+			ansi.Printf("  @B{ttl}           @G{%s}\n", info.TTL)
+			ansi.Printf("  @B{renewable}     @G{%t}\n", info.Renewable)
+			return nil
+		}
+		return fmt.Errorf("USAGE: lease renew|revoke|revoke-prefix|lookup lease-id")
+	})
+
+	r.Dispatch("token", func(command string, args ...string) error {
+		rc.Apply()
+		policies := getopt.ListLong("policy", 0, "", "Comma-separated list of policies for the new token")
+		ttl := getopt.StringLong("ttl", 0, "", "How long the new token lives for (i.e. 1h)")
+		maxTTL := getopt.StringLong("explicit-max-ttl", 0, "", "How long the new token (or tokens of the role) can be renewed for, at most")
+		period := getopt.StringLong("period", 0, "", "Make the new token (or tokens of the role) periodic, renewable every period (i.e. 24h)")
+		orphan := getopt.BoolLong("orphan", 0, "Create the new token (or tokens of the role) without a parent")
+		uses := getopt.IntLong("use-limit", 0, 0, "Number of times the new token can be used")
+		name := getopt.StringLong("display-name", 0, "", "Display name for the new token")
+		role := getopt.StringLong("role", 0, "", "Token role to create the new token against")
+		renewable := getopt.StringLong("renewable", 0, "", "Whether or not the new token (or tokens of the role) can be renewed (true or false)")
+		store := getopt.StringLong("store", 0, "", "Store the new token and its accessor at this path, instead of printing the token")
+		accessor := getopt.BoolLong("accessor", 0, "Look up (or revoke) tokens by accessor, instead of by token")
+		allowed := getopt.ListLong("allowed-policy", 0, "", "Comma-separated list of policies that tokens of the role can have")
+		disallowed := getopt.ListLong("disallowed-policy", 0, "", "Comma-separated list of policies that tokens of the role cannot have")
+		args = parseOptions(command, args...)
+		if len(args) < 1 {
+			return fmt.Errorf("USAGE: token create|lookup|revoke|roles|role ...")
+		}
+		sub, args := args[0], args[1:]
+
+		var renew *bool
+		if *renewable != "" {
+			b, err := strconv.ParseBool(*renewable)
+			if err != nil {
+				return fmt.Errorf("invalid --renewable '%s' (must be true or false)", *renewable)
+			}
+			renew = &b
+		}
+
+		v := connect()
+		switch sub {
+		case "create":
+			if len(args) != 0 {
+				return fmt.Errorf("USAGE: token create [--policy p,...] [--ttl 1h] [--period 24h] [--orphan] [--use-limit N] [--display-name name] [--role name] [--store path]")
+			}
+			if *orphan && *role != "" {
+				return fmt.Errorf("--orphan cannot be used with --role (the role decides whether or not its tokens are orphans)")
+			}
+			t, err := v.CreateToken(ctx, vault.TokenRequest{
+				Role:           *role,
+				Orphan:         *orphan,
+				Policies:       *policies,
+				TTL:            *ttl,
+				ExplicitMaxTTL: *maxTTL,
+				Period:         *period,
+				NumUses:        *uses,
+				DisplayName:    *name,
+				Renewable:      renew,
+			})
+			if err != nil {
+				return err
+			}
+
+			if *store != "" {
+				err := v.Update(ctx, *store, func(s *vault.Secret) error {
+					s.Set("token", t.Token)
+					s.Set("accessor", t.Accessor)
+					return nil
+				})
+				if err != nil {
+					/* don't leave a token lying around that nobody knows */
+					if rerr := v.RevokeAccessor(ctx, t.Accessor); rerr != nil {
+						fmt.Printf("%s\n", t.Token)
+						return fmt.Errorf("unable to store the new token at %s (%s), or to revoke it (%s); it was printed above instead", *store, err, rerr)
+					}
+					return fmt.Errorf("unable to store the new token at %s (so it was revoked): %s", *store, err)
+				}
+				ansi.Fprintf(os.Stderr, "Stored the new token (accessor @C{%s}) at @C{%s}\n", t.Accessor, *store)
+				return nil
+			}
+
+			expires := "never"
+			if t.TTL > 0 {
+				expires = fmt.Sprintf("in %s (%s)", t.TTL, time.Now().Add(t.TTL).Format("2006-01-02 15:04:05"))
+			}
+			ansi.Printf("  @B{token}      @G{%s}\n", t.Token)
+			ansi.Printf("  @B{accessor}   @G{%s}\n", t.Accessor)
+			ansi.Printf("  @B{policies}   @G{%s}\n", strings.Join(t.Policies, ", "))
+			ansi.Printf("  @B{expires}    @G{%s}\n", expires)
+			ansi.Printf("  @B{renewable}  @G{%t}\n", t.Renewable)
+			return nil
+
+		case "lookup":
+			if len(args) != 1 {
+				return fmt.Errorf("USAGE: token lookup [--accessor] token|accessor")
+			}
+			var info *vault.TokenInfo
+			var err error
+			if *accessor {
+				info, err = v.LookupAccessor(ctx, args[0])
+			} else {
+				info, err = v.LookupToken(ctx, args[0])
+			}
+			if err != nil {
+				return err
+			}
+
+			expires := "never"
+			if info.TTL > 0 {
+				expires = fmt.Sprintf("in %s (%s)", info.TTL, time.Now().Add(info.TTL).Format("2006-01-02 15:04:05"))
+			}
+			uses := "unlimited"
+			if info.NumUses > 0 {
+				uses = strconv.Itoa(info.NumUses)
+			}
+			ansi.Printf("  @B{name}       @G{%s}\n", info.DisplayName)
+			ansi.Printf("  @B{accessor}   @G{%s}\n", info.Accessor)
+			ansi.Printf("  @B{policies}   @G{%s}\n", strings.Join(info.Policies, ", "))
+			ansi.Printf("  @B{expires}    @G{%s}\n", expires)
+			ansi.Printf("  @B{renewable}  @G{%t}\n", info.Renewable)
+			ansi.Printf("  @B{orphan}     @G{%t}\n", info.Orphan)
+			ansi.Printf("  @B{uses left}  @G{%s}\n", uses)
+			return nil
+
+		case "revoke":
+			if len(args) < 1 {
+				return fmt.Errorf("USAGE: token revoke [--accessor] token|accessor [...]")
+			}
+			for _, arg := range args {
+				if *accessor {
+					if err := v.RevokeAccessor(ctx, arg); err != nil {
+						return err
+					}
+					ansi.Fprintf(os.Stderr, "Revoked the token with accessor @C{%s}\n", arg)
+				} else {
+					if err := v.RevokeToken(ctx, arg); err != nil {
+						return err
+					}
+					ansi.Fprintf(os.Stderr, "Revoked the token\n")
+				}
+			}
+			return nil
+
+		case "roles":
+			if len(args) != 0 {
+				return fmt.Errorf("USAGE: token roles")
+			}
+			roles, err := v.TokenRoles(ctx)
+			if err != nil {
+				return err
+			}
+			for _, role := range roles {
+				fmt.Printf("%s\n", role)
+			}
+			return nil
+
+		case "role":
+			if len(args) != 2 {
+				return fmt.Errorf("USAGE: token role get|set|delete name")
+			}
+			switch args[0] {
+			case "get":
+				r, err := v.TokenRole(ctx, args[1])
+				if err == vault.NotFound {
+					return fmt.Errorf("no such token role '%s'", args[1])
+				}
+				if err != nil {
+					return err
+				}
+				ansi.Printf("  @B{allowed policies}     @G{%s}\n", strings.Join(r.AllowedPolicies, ", "))
+				ansi.Printf("  @B{disallowed policies}  @G{%s}\n", strings.Join(r.DisallowedPolicies, ", "))
+				ansi.Printf("  @B{orphan}               @G{%t}\n", r.Orphan)
+				ansi.Printf("  @B{renewable}            @G{%t}\n", r.Renewable)
+				ansi.Printf("  @B{period}               @G{%s}\n", r.Period)
+				ansi.Printf("  @B{explicit max ttl}     @G{%s}\n", r.ExplicitMaxTTL)
+				return nil
+
+			case "set":
+				r := vault.TokenRole{
+					AllowedPolicies:    *allowed,
+					DisallowedPolicies: *disallowed,
+					Orphan:             *orphan,
+					Renewable:          renew == nil || *renew,
+				}
+				for _, d := range []struct {
+					flag  string
+					value string
+					into  *time.Duration
+				}{
+					{"period", *period, &r.Period},
+					{"explicit-max-ttl", *maxTTL, &r.ExplicitMaxTTL},
+				} {
+					if d.value == "" {
+						continue
+					}
+					t, err := time.ParseDuration(d.value)
+					if err != nil || t < 0 {
+						return fmt.Errorf("invalid --%s '%s' (try something like 24h)", d.flag, d.value)
+					}
+					*d.into = t
+				}
+				return v.SetTokenRole(ctx, args[1], r)
+
+			case "delete":
+				return v.DeleteTokenRole(ctx, args[1])
+			}
+			return fmt.Errorf("USAGE: token role get|set|delete name")
+		}
+		return fmt.Errorf("USAGE: token create|lookup|revoke|roles|role ...")
+	})
+
+	r.Dispatch("can", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) < 1 {
+			return fmt.Errorf("USAGE: can path [path ...]")
+		}
+
+		v := connect()
+		caps, err := v.Capabilities(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		width := 0
+		for _, path := range args {
+			if len(path) > width {
+				width = len(path)
+			}
+		}
+		for _, path := range args {
+			l := caps[path]
+			if len(l) == 0 || (len(l) == 1 && l[0] == "deny") {
+				ansi.Printf("  @B{%s}  @R{deny}\n", fmt.Sprintf("%-*s", width, path))
+				continue
+			}
+			ansi.Printf("  @B{%s}  @G{%s}\n", fmt.Sprintf("%-*s", width, path), strings.Join(l, ", "))
+		}
+		return nil
+	})
+
+	r.Dispatch("env", func(command string, args ...string) error {
+		rc.Apply()
+		ansi.Fprintf(os.Stderr, "  @B{VAULT_ADDR}  @G{%s}\n", os.Getenv("VAULT_ADDR"))
+		ansi.Fprintf(os.Stderr, "  @B{VAULT_TOKEN} @G{%s}\n", os.Getenv("VAULT_TOKEN"))
+		if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+			ansi.Fprintf(os.Stderr, "  @B{VAULT_NAMESPACE} @G{%s}\n", ns)
+		}
+		for _, name := range []string{"VAULT_CACERT", "VAULT_CAPATH", "VAULT_CLIENT_CERT", "VAULT_CLIENT_KEY", "VAULT_TLS_SERVER_NAME"} {
+			if val := os.Getenv(name); val != "" {
+				ansi.Fprintf(os.Stderr, "  @B{%s} @G{%s}\n", name, val)
+			}
+		}
+		return nil
+	})
+
+	r.Dispatch("auth", func(command string, args ...string) error {
+		cfg := rc.Apply()
+
+		method := "token"
+		if len(args) > 0 {
+			method = args[0]
+			args = args[1:]
+		}
+
+		var token string
+		var err error
+
+		ansi.Fprintf(os.Stderr, "Authenticating against @C{%s} at @C{%s}\n", cfg.Current, cfg.URL())
+		switch method {
+		case "token":
+			token, err = auth.Token(ctx, os.Getenv("VAULT_ADDR"))
+			if err != nil {
+				return err
+			}
+			break
+
+		case "ldap":
+			token, err = auth.LDAP(ctx, os.Getenv("VAULT_ADDR"))
+			if err != nil {
+				return err
+			}
+			break
+
+		case "github":
+			token, err = auth.Github(ctx, os.Getenv("VAULT_ADDR"))
+			if err != nil {
+				return err
+			}
+			break
+
+		default:
+			return fmt.Errorf("Unrecognized authentication method '%s'", method)
+		}
+
+		cfg.SetToken(token)
+		return cfg.Write()
+
+	}, "login")
+
+	r.Dispatch("logout", func(command string, args ...string) error {
+		cfg := rc.Apply()
+		all := getopt.BoolLong("all", 'a', "Log out of every Vault that has been targeted")
+		args = parseOptions(command, args...)
+		if len(args) != 0 {
+			return fmt.Errorf("USAGE: logout [--all]")
+		}
+
+		urls := cfg.URLs()
+		if !*all {
+			if cfg.URL() == "" {
+				return fmt.Errorf("No target selected")
+			}
+			urls = []string{cfg.URL()}
+		}
+
+		failed := 0
+		for _, url := range urls {
+			cfg.WithTarget(url, func() {
+				token := os.Getenv("VAULT_TOKEN")
+				if token == "" {
+					return
+				}
+
+				v, err := vault.NewVault(url, token)
+				if err == nil {
+					err = v.RevokeSelf(ctx)
+				}
+				/* a token that the Vault won't accept anymore is
+				   as good as revoked, so we can forget about it */
+				if err != nil && !vault.IsPermissionDenied(err) {
+					ansi.Fprintf(os.Stderr, "@R{!! unable to revoke your token for %s: %s}\n", url, err)
+					failed++
+					return
+				}
+
+				cfg.ClearToken(url)
+				if err := rc.ForgetVaultToken(token); err != nil {
+					ansi.Fprintf(os.Stderr, "@Y{unable to remove ~/.vault-token: %s}\n", err)
+				}
+				ansi.Fprintf(os.Stderr, "Logged out of @C{%s}\n", url)
+			})
+		}
+
+		if err := cfg.Write(); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("unable to log out of %d Vault(s); the token(s) for them were kept", failed)
+		}
+		return nil
+	})
+
+	r.Dispatch("set", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) < 2 {
+			return fmt.Errorf("USAGE: set path key[=value|:=json] [key ...]")
+		}
+		v := connect()
+		path, args := args[0], args[1:]
+		var keys []string
+		var values []interface{}
+		for _, set := range args {
+			k, val, err := keyPrompt(set, true)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+			values = append(values, val)
+		}
+		return v.Update(ctx, path, func(s *vault.Secret) error {
+			for i := range keys {
+				s.SetValue(keys[i], values[i])
+			}
+			return nil
+		})
+	}, "write")
+
+	r.Dispatch("paste", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) < 2 {
+			return fmt.Errorf("USAGE: paste path key[=value|:=json] [key ...]")
+		}
+		v := connect()
+		path, args := args[0], args[1:]
+		var keys []string
+		var values []interface{}
+		for _, set := range args {
+			k, val, err := keyPrompt(set, false)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+			values = append(values, val)
+		}
+		return v.Update(ctx, path, func(s *vault.Secret) error {
+			for i := range keys {
+				s.SetValue(keys[i], values[i])
+			}
+			return nil
+		})
+	})
+
+	r.Dispatch("get", func(command string, args ...string) error {
+		rc.Apply()
+
+		meta := getopt.BoolLong("meta", 0, "Show the custom metadata of each secret, as YAML comments")
+		args = parseOptions(command, args...)
+
+		if len(args) < 1 {
+			return fmt.Errorf("USAGE: get [--meta] path [path ...]")
+		}
+		v := connect()
+		for _, path := range args {
+			s, err := v.Read(ctx, path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("--- # %s\n", path)
+			if *meta {
+				m := s.Metadata()
+				keys := make([]string, 0, len(m))
+				for k := range m {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Printf("# %s: %s\n", k, m[k])
+				}
+			}
+			fmt.Printf("%s\n\n", s.YAML())
+		}
+		return nil
+	}, "read", "cat")
+
+	r.Dispatch("meta", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) < 2 {
+			return fmt.Errorf("USAGE: meta get|set|unset path [key[=value] ...]")
+		}
+		sub, path, args := args[0], args[1], args[2:]
+
+		v := connect()
+		switch sub {
+		case "get":
+			if len(args) != 0 {
+				return fmt.Errorf("USAGE: meta get path")
+			}
+			m, err := v.Metadata(ctx, path)
+			if err != nil {
+				return err
+			}
+			b, err := yaml.Marshal(m)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("--- # %s\n", path)
+			fmt.Printf("%s\n\n", b)
+			return nil
+
+		case "set":
+			if len(args) == 0 {
+				return fmt.Errorf("USAGE: meta set path key=value [key=value ...]")
+			}
+			m, err := v.Metadata(ctx, path)
+			if err != nil && err != vault.NotFound {
+				return err
+			}
+			if m == nil {
+				m = make(map[string]string)
+			}
+			for _, set := range args {
+				l := strings.SplitN(set, "=", 2)
+				if len(l) != 2 || l[0] == "" {
+					return fmt.Errorf("USAGE: meta set path key=value [key=value ...]")
+				}
+				m[l[0]] = l[1]
+			}
+			return v.SetMetadata(ctx, path, m)
+
+		case "unset":
+			if len(args) == 0 {
+				return fmt.Errorf("USAGE: meta unset path key [key ...]")
+			}
+			m, err := v.Metadata(ctx, path)
+			if err != nil {
+				return err
+			}
+			for _, key := range args {
+				delete(m, key)
+			}
+			return v.SetMetadata(ctx, path, m)
+		}
+		return fmt.Errorf("USAGE: meta get|set|unset path [key[=value] ...]")
+	})
+
+	r.Dispatch("versions", func(command string, args ...string) error {
+		rc.Apply()
+		if len(args) != 1 {
+			return fmt.Errorf("USAGE: versions path")
+		}
+		v := connect()
+		versions, err := v.Versions(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		stamp := func(t time.Time) string {
+			if t.IsZero() {
+				return "-"
+			}
+			return t.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-8s  %-19s  %-19s  %s\n", "version", "created", "deleted", "destroyed")
+		for _, ver := range versions {
+			line := fmt.Sprintf("%-8d  %-19s  %-19s  %v", ver.Version, stamp(ver.Created), stamp(ver.Deleted), ver.Destroyed)
+			switch {
+			case ver.Destroyed:
+				ansi.Printf("@R{%s}\n", line)
+			case !ver.Deleted.IsZero():
+				ansi.Printf("@Y{%s}\n", line)
+			default:
+				fmt.Printf("%s\n", line)
+			}
 		}
-		return v.Write(path, s)
+		return nil
 	})
 
-	r.Dispatch("get", func(command string, args ...string) error {
+	r.Dispatch("rollback", func(command string, args ...string) error {
 		rc.Apply()
-		if len(args) < 1 {
-			return fmt.Errorf("USAGE: get path [path ...]")
+		if len(args) != 2 {
+			return fmt.Errorf("USAGE: rollback path version")
 		}
-		v := connect()
-		for _, path := range args {
-			s, err := v.Read(path)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("--- # %s\n", path)
-			fmt.Printf("%s\n\n", s.YAML())
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil || version == 0 {
+			return fmt.Errorf("USAGE: rollback path version")
 		}
-		return nil
-	}, "read", "cat")
+		v := connect()
+		return v.Rollback(ctx, args[0], int(version))
+	})
 
 	r.Dispatch("tree", func(command string, args ...string) error {
 		rc.Apply()
+
+		meta := getopt.BoolLong("meta", 0, "Show the custom metadata of each secret")
+		args = parseOptions(command, args...)
+
 		if len(args) == 0 {
 			args = append(args, "secret")
 		}
 		v := connect()
 		for _, path := range args {
-			tree, err := v.Tree(path, true)
+			tree, err := v.Tree(ctx, path, vault.TreeOptions{Ansify: true, Meta: *meta})
 			if err != nil {
 				return err
 			}
@@ -376,17 +2189,33 @@ func main() {
 
 	r.Dispatch("paths", func(command string, args ...string) error {
 		rc.Apply()
+
+		meta := getopt.BoolLong("meta", 0, "Show the custom metadata of each secret")
+		args = parseOptions(command, args...)
+
 		if len(args) < 1 {
-			return fmt.Errorf("USAGE: paths path [path ...]")
+			return fmt.Errorf("USAGE: paths [--meta] path [path ...]")
 		}
 		v := connect()
 		for _, path := range args {
-			tree, err := v.Tree(path, false)
+			tree, err := v.Tree(ctx, path, vault.TreeOptions{})
 			if err != nil {
 				return err
 			}
-			for _, s := range tree.Paths("/") {
-				fmt.Printf("%s\n", s)
+			paths := tree.Paths("/")
+
+			var all map[string]map[string]string
+			if *meta {
+				if all, err = v.MetadataAll(ctx, paths); err != nil {
+					return err
+				}
+			}
+			for _, s := range paths {
+				if m, ok := all[s]; ok {
+					fmt.Printf("%s  [%s]\n", s, vault.FormatMetadata(m))
+				} else {
+					fmt.Printf("%s\n", s)
+				}
 			}
 		}
 		return nil
@@ -395,19 +2224,40 @@ func main() {
 	r.Dispatch("delete", func(command string, args ...string) error {
 		rc.Apply()
 
+		destroy := getopt.BoolLong("destroy", 0, "Permanently remove all versions and metadata")
 		recurse, args := shouldRecurse(command, args...)
 
 		if len(args) < 1 {
-			return fmt.Errorf("USAGE: delete path [path ...]")
+			return fmt.Errorf("USAGE: delete [--destroy] path [path ...]")
+		}
+		if *destroy && !recurse && !getopt.Lookup("force").Seen() {
+			confirm("Are you sure you wish to permanently destroy all versions of %s?", strings.Join(args, " "))
 		}
 		v := connect()
+		del := v.Delete
+		if *destroy {
+			del = v.DestroyAll
+		}
+		if recurse {
+			err := confirmRecurse(command, args, func() error {
+				for _, path := range args {
+					if err := v.PreflightDeleteTree(ctx, path, *destroy); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
 		for _, path := range args {
 			if recurse {
-				if err := v.DeleteTree(path); err != nil {
+				if err := v.DeleteTree(ctx, path, del); err != nil {
 					return err
 				}
 			} else {
-				if err := v.Delete(path); err != nil {
+				if err := del(ctx, path); err != nil {
 					return err
 				}
 			}
@@ -415,6 +2265,107 @@ func main() {
 		return nil
 	}, "rm")
 
+	r.Dispatch("undelete", func(command string, args ...string) error {
+		rc.Apply()
+
+		list := getopt.ListLong("versions", 0, "", "Comma-separated list of versions to undelete")
+		args = parseOptions(command, args...)
+
+		if len(args) != 1 {
+			return fmt.Errorf("USAGE: undelete path [--versions 1,2,...]")
+		}
+		versions, err := parseVersions(*list)
+		if err != nil {
+			return err
+		}
+
+		v := connect()
+		return v.Undelete(ctx, args[0], versions)
+	})
+
+	r.Dispatch("destroy", func(command string, args ...string) error {
+		rc.Apply()
+
+		list := getopt.ListLong("versions", 0, "", "Comma-separated list of versions to destroy")
+		all := getopt.BoolLong("all", 'a', "Destroy all versions, and the metadata")
+		force := getopt.BoolLong("force", 'f', "Disable confirmation prompting")
+		args = parseOptions(command, args...)
+
+		if len(args) != 1 || (*all && len(*list) > 0) {
+			return fmt.Errorf("USAGE: destroy path [--versions 1,2,...|--all]")
+		}
+		versions, err := parseVersions(*list)
+		if err != nil {
+			return err
+		}
+
+		path := args[0]
+		if !*force {
+			switch {
+			case *all:
+				confirm("Are you sure you wish to permanently destroy all versions of %s?", path)
+			case len(versions) > 0:
+				confirm("Are you sure you wish to permanently destroy versions %s of %s?", strings.Join(*list, ","), path)
+			default:
+				confirm("Are you sure you wish to permanently destroy the latest version of %s?", path)
+			}
+		}
+
+		v := connect()
+		if *all {
+			return v.DestroyAll(ctx, path)
+		}
+		return v.Destroy(ctx, path, versions)
+	})
+
+	r.Dispatch("wrap", func(command string, args ...string) error {
+		rc.Apply()
+
+		ttl := getopt.StringLong("ttl", 0, "1h", "How long until the wrapping token expires")
+		args = parseOptions(command, args...)
+
+		if len(args) != 1 {
+			return fmt.Errorf("USAGE: wrap [--ttl 1h] path[:key]")
+		}
+
+		v := connect()
+		w, err := v.Wrap(ctx, args[0], *ttl)
+		if err != nil {
+			return err
+		}
+		ansi.Fprintf(os.Stderr, "Wrapped @C{%s} in a single-use token, valid until @C{%s}\n",
+			args[0], w.Created.Add(w.TTL).Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("%s\n", w.Token)
+		return nil
+	})
+
+	r.Dispatch("unwrap", func(command string, args ...string) error {
+		rc.Apply()
+
+		to := getopt.StringLong("to", 0, "", "Store the unwrapped secret at this path, instead of printing it")
+		args = parseOptions(command, args...)
+
+		if len(args) != 1 {
+			return fmt.Errorf("USAGE: unwrap [--to path] token")
+		}
+
+		v := connect()
+		s, err := v.Unwrap(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if *to != "" {
+			if err = v.Write(ctx, *to, s); err != nil {
+				return err
+			}
+			ansi.Fprintf(os.Stderr, "Unwrapped secret stored at @C{%s}\n", *to)
+			return nil
+		}
+		fmt.Printf("--- # (unwrapped)\n")
+		fmt.Printf("%s\n\n", s.YAML())
+		return nil
+	})
+
 	r.Dispatch("export", func(command string, args ...string) error {
 		rc.Apply()
 		if len(args) < 1 {
@@ -423,15 +2374,15 @@ func main() {
 		v := connect()
 		data := make(map[string]*vault.Secret)
 		for _, path := range args {
-			tree, err := v.Tree(path, false)
+			tree, err := v.Tree(ctx, path, vault.TreeOptions{})
 			if err != nil {
 				return err
 			}
-			for _, sub := range tree.Paths("/") {
-				s, err := v.Read(sub)
-				if err != nil {
-					return err
-				}
+			secrets, err := v.ReadAll(ctx, tree.Paths("/"))
+			if err != nil {
+				return err
+			}
+			for sub, s := range secrets {
 				data[sub] = s
 			}
 		}
@@ -459,7 +2410,7 @@ func main() {
 
 		v := connect()
 		for path, s := range data {
-			err = v.Write(path, s)
+			err = v.Write(ctx, path, s)
 			if err != nil {
 				return err
 			}
@@ -474,16 +2425,22 @@ func main() {
 		recurse, args := shouldRecurse(command, args...)
 
 		if len(args) != 2 {
-			return fmt.Errorf("USAGE: move oldpath newpath", args)
+			return fmt.Errorf("USAGE: move oldpath newpath")
 		}
 		v := connect()
 
 		if recurse {
-			if err := v.MoveCopyTree(args[0], args[1], v.Move); err != nil {
+			err := confirmRecurse(command, args, func() error {
+				return v.PreflightMoveCopyTree(ctx, args[0], args[1], true)
+			})
+			if err != nil {
+				return err
+			}
+			if err := v.MoveCopyTree(ctx, args[0], args[1], v.Move); err != nil {
 				return err
 			}
 		} else {
-			if err := v.Move(args[0], args[1]); err != nil {
+			if err := v.Move(ctx, args[0], args[1]); err != nil {
 				return err
 			}
 		}
@@ -496,16 +2453,22 @@ func main() {
 		recurse, args := shouldRecurse(command, args...)
 
 		if len(args) != 2 {
-			return fmt.Errorf("USAGE: copy oldpath newpath", args)
+			return fmt.Errorf("USAGE: copy oldpath newpath")
 		}
 		v := connect()
 
 		if recurse {
-			if err := v.MoveCopyTree(args[0], args[1], v.Copy); err != nil {
+			err := confirmRecurse(command, args, func() error {
+				return v.PreflightMoveCopyTree(ctx, args[0], args[1], false)
+			})
+			if err != nil {
+				return err
+			}
+			if err := v.MoveCopyTree(ctx, args[0], args[1], v.Copy); err != nil {
 				return err
 			}
 		} else {
-			if err := v.Copy(args[0], args[1]); err != nil {
+			if err := v.Copy(ctx, args[0], args[1]); err != nil {
 				return err
 			}
 		}
@@ -528,16 +2491,10 @@ func main() {
 
 		v := connect()
 		path, key := args[0], args[1]
-		s, err := v.Read(path)
-		if err != nil && err != vault.NotFound {
-			return err
-		}
-		s.Password(key, length)
-
-		if err = v.Write(path, s); err != nil {
-			return err
-		}
-		return nil
+		return v.Update(ctx, path, func(s *vault.Secret) error {
+			s.Password(key, length)
+			return nil
+		})
 	}, "auto")
 
 	r.Dispatch("ssh", func(command string, args ...string) error {
@@ -556,14 +2513,10 @@ func main() {
 
 		v := connect()
 		for _, path := range args {
-			s, err := v.Read(path)
-			if err != nil && err != vault.NotFound {
-				return err
-			}
-			if err = s.SSHKey(bits); err != nil {
-				return err
-			}
-			if err = v.Write(path, s); err != nil {
+			err := v.Update(ctx, path, func(s *vault.Secret) error {
+				return s.SSHKey(bits)
+			})
+			if err != nil {
 				return err
 			}
 		}
@@ -586,14 +2539,10 @@ func main() {
 
 		v := connect()
 		for _, path := range args {
-			s, err := v.Read(path)
-			if err != nil && err != vault.NotFound {
-				return err
-			}
-			if err = s.RSAKey(bits); err != nil {
-				return err
-			}
-			if err = v.Write(path, s); err != nil {
+			err := v.Update(ctx, path, func(s *vault.Secret) error {
+				return s.RSAKey(bits)
+			})
+			if err != nil {
 				return err
 			}
 		}
@@ -617,14 +2566,17 @@ func main() {
 
 		path := args[0]
 		v := connect()
-		s, err := v.Read(path)
-		if err != nil && err != vault.NotFound {
-			return err
-		}
-		if err = s.DHParam(bits); err != nil {
+
+		/* generating primes takes a while; do it once, up front,
+		   rather than every time the update has to be retried */
+		dh := vault.NewSecret()
+		if err := dh.DHParam(bits); err != nil {
 			return err
 		}
-		return v.Write(path, s)
+		return v.Update(ctx, path, func(s *vault.Secret) error {
+			s.Set("dhparam-pem", dh.Get("dhparam-pem"))
+			return nil
+		})
 	}, "dh", "dhparams")
 
 	r.Dispatch("prompt", func(command string, args ...string) error {
@@ -660,37 +2612,33 @@ func main() {
 		newKey := args[3]
 
 		v := connect()
-		s, err := v.Read(path)
-		if err != nil {
-			return err
-		}
-		if err = s.Format(oldKey, newKey, fmtType); err != nil {
-			if err == vault.NotFound {
-				return fmt.Errorf("%s:%s does not exist, cannot create %s encoded copy at %s:%s", path, oldKey, fmtType, path, newKey)
+		return v.Update(ctx, path, func(s *vault.Secret) error {
+			if err := s.Format(oldKey, newKey, fmtType); err != nil {
+				if err == vault.NotFound {
+					return fmt.Errorf("%s:%s does not exist, cannot create %s encoded copy at %s:%s", path, oldKey, fmtType, path, newKey)
+				}
+				return fmt.Errorf("Error encoding %s:%s as %s: %s", path, oldKey, fmtType, err)
 			}
-			return fmt.Errorf("Error encoding %s:%s as %s: %s", path, oldKey, fmtType, err)
-		}
-
-		return v.Write(path, s)
+			return nil
+		})
 	})
 
 	r.Dispatch("crl-pem", func(command string, args ...string) error {
 		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "pki", "Path that the PKI backend is mounted at")
+		args = parseOptions(command, args...)
 
 		v := connect()
-		pem, err := v.RetrievePem("crl")
+		pem, err := v.RetrievePem(ctx, *backend, "crl")
 		if err != nil {
 			return err
 		}
 
 		if len(args) > 0 {
-			path := args[0]
-			s, err := v.Read(path)
-			if err != nil && err != vault.NotFound {
-				return err
-			}
-			s.Set("crl-pem", string(pem))
-			return v.Write(path, s)
+			return v.Update(ctx, args[0], func(s *vault.Secret) error {
+				s.Set("crl-pem", string(pem))
+				return nil
+			})
 		} else {
 			if len(pem) == 0 {
 				ansi.Fprintf(os.Stderr, "@Y{No CRL exists yet}\n")
@@ -703,21 +2651,20 @@ func main() {
 
 	r.Dispatch("ca-pem", func(command string, args ...string) error {
 		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "pki", "Path that the PKI backend is mounted at")
+		args = parseOptions(command, args...)
 
 		v := connect()
-		pem, err := v.RetrievePem("ca")
+		pem, err := v.RetrievePem(ctx, *backend, "ca")
 		if err != nil {
 			return err
 		}
 
 		if len(args) > 0 {
-			path := args[0]
-			s, err := v.Read(path)
-			if err != nil && err != vault.NotFound {
-				return err
-			}
-			s.Set("ca-pem", string(pem))
-			return v.Write(path, s)
+			return v.Update(ctx, args[0], func(s *vault.Secret) error {
+				s.Set("ca-pem", string(pem))
+				return nil
+			})
 		} else {
 			if len(pem) == 0 {
 				ansi.Fprintf(os.Stderr, "@Y{No CA exists yet}\n")
@@ -740,21 +2687,9 @@ func main() {
 		ip_sans := getopt.StringLong("ip-sans", 0, "", "Comma-separated list of IP SANs")
 		alt_names := getopt.StringLong("alt-names", 0, "", "Comma-separated list of SANs")
 		exclude_cn_from_sans := getopt.BoolLong("exclude-cn-from-sans", 0, "", "Exclude the common_name from DNS or Email SANs")
+		backend := getopt.StringLong("backend", 0, "pki", "Path that the PKI backend is mounted at")
 
-		args = append([]string{"safe " + command}, args...)
-
-		var opts = getopt.CommandLine
-		var parsed []string
-		for {
-			opts.Parse(args)
-			if opts.NArgs() == 0 {
-				break
-			}
-			parsed = append(parsed, opts.Arg(0))
-			args = opts.Args()
-		}
-
-		args = parsed
+		args = parseOptions(command, args...)
 
 		params := vault.CertOptions{
 			TTL:               *ttl,
@@ -769,18 +2704,20 @@ func main() {
 
 		v := connect()
 		role, path := args[0], args[1]
-		return v.CreateSignedCertificate(role, path, params)
+		return v.CreateSignedCertificate(ctx, *backend, role, path, params)
 	})
 
 	r.Dispatch("revoke", func(command string, args ...string) error {
 		rc.Apply()
+		backend := getopt.StringLong("backend", 0, "pki", "Path that the PKI backend is mounted at")
+		args = parseOptions(command, args...)
 
 		if len(args) != 1 {
-			return fmt.Errorf("USAGE: revoke path|serial")
+			return fmt.Errorf("USAGE: revoke [--backend pki] path|serial")
 		}
 
 		v := connect()
-		return v.RevokeCertificate(args[0])
+		return v.RevokeCertificate(ctx, *backend, args[0])
 	})
 
 	r.Dispatch("curl", func(command string, args ...string) error {
@@ -791,7 +2728,7 @@ func main() {
 		}
 
 		v := connect()
-		res, err := v.Curl(strings.ToUpper(args[0]), args[1], []byte(strings.Join(args[2:], " ")))
+		res, err := v.Curl(ctx, strings.ToUpper(args[0]), args[1], []byte(strings.Join(args[2:], " ")))
 		if err != nil {
 			return err
 		}
@@ -801,7 +2738,10 @@ func main() {
 		return nil
 	})
 
+	cas := getopt.BoolLong("cas", 0, "Fail, rather than retry, when a secret is modified by someone else while safe is updating it")
 	insecure := getopt.BoolLong("insecure", 'k', "Disable SSL/TLS certificate validation")
+	timeout := getopt.StringLong("timeout", 0, "", "How long to wait for each request to Vault (i.e. 30s or 2m), or 0 to wait forever")
+	concurrency := getopt.IntLong("concurrency", 0, 0, "Number of requests to make to Vault at once, when walking trees")
 	showVersion := getopt.BoolLong("version", 'v', "Print version information and exit")
 	showHelp := getopt.BoolLong("help", 'h', "Get some help")
 	opts := getopt.CommandLine
@@ -824,6 +2764,15 @@ func main() {
 	if *insecure {
 		os.Setenv("VAULT_SKIP_VERIFY", "1")
 	}
+	if *cas {
+		os.Setenv("SAFE_CAS", "1")
+	}
+	if *concurrency > 0 {
+		os.Setenv("SAFE_CONCURRENCY", strconv.Itoa(*concurrency))
+	}
+	if *timeout != "" {
+		os.Setenv("VAULT_CLIENT_TIMEOUT", *timeout)
+	}
 
 	if err := r.Run(args...); err != nil {
 		if strings.HasPrefix(err.Error(), "USAGE") {
@@ -831,16 +2780,48 @@ func main() {
 		} else {
 			ansi.Fprintf(os.Stderr, "@R{!! %s}\n", err)
 		}
-		os.Exit(1)
+		if e, ok := err.(*vault.IncompleteError); ok {
+			incomplete(e)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
-func shouldRecurse(cmd string, args ...string) (bool, []string) {
-	var recursiveMode, forceMode *bool
+// exitCode picks the exit status for a command that failed with err, so
+// that scripts can tell the most common failures apart (see the help).
+func exitCode(err error) int {
+	switch {
+	case vault.IsPermissionDenied(err):
+		return 3
+	case vault.IsNotFound(err):
+		return 4
+	case vault.IsSealed(err):
+		return 5
+	}
+	return 1
+}
 
-	forceMode = getopt.BoolLong("force", 'f', "Disable confirmation prompting")
-	recursiveMode = getopt.BoolLong("recursive", 'R', "Enable recursion")
+// incomplete explains which paths an interrupted tree operation did and
+// did not get to, so that it can be finished (or undone) by hand.
+func incomplete(e *vault.IncompleteError) {
+	if len(e.Done) > 0 {
+		ansi.Fprintf(os.Stderr, "\n@G{Processed:}\n")
+		for _, path := range e.Done {
+			ansi.Fprintf(os.Stderr, "  @G{%s}\n", path)
+		}
+	}
+	if len(e.Pending) > 0 {
+		ansi.Fprintf(os.Stderr, "\n@Y{Not processed:}\n")
+		for _, path := range e.Pending {
+			ansi.Fprintf(os.Stderr, "  @Y{%s}\n", path)
+		}
+	}
+}
 
+// parseOptions runs the flags registered with getopt over the arguments
+// to a sub-command, returning the remaining (non-flag) arguments,
+// regardless of where the flags appeared.
+func parseOptions(cmd string, args ...string) []string {
 	args = append([]string{"safe " + cmd}, args...)
 
 	var opts = getopt.CommandLine
@@ -854,18 +2835,266 @@ func shouldRecurse(cmd string, args ...string) (bool, []string) {
 		args = opts.Args()
 	}
 
-	args = parsed
+	return parsed
+}
+
+// applyPolicies brings the ACL policies in the Vault in line with the
+// *.hcl files in a directory (each named after its policy), showing the
+// differences and writing only the policies that changed.  With prune,
+// policies that have no file are deleted (except for the built-in root
+// and default policies).
+func applyPolicies(v *vault.Vault, dir string, prune, dryRun bool) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.hcl"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no policies (*.hcl files) found in %s", dir)
+	}
+
+	var names []string
+	local := make(map[string]string)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".hcl")
+		names = append(names, name)
+		local[name] = string(b)
+	}
+	sort.Strings(names)
+
+	changed := 0
+	for _, name := range names {
+		remote, err := v.Policy(ctx, name)
+		if err != nil && err != vault.NotFound {
+			return err
+		}
+		if strings.TrimSpace(remote) == strings.TrimSpace(local[name]) {
+			continue
+		}
+
+		if err == vault.NotFound {
+			ansi.Printf("@G{+ policy %s} (new)\n", name)
+		} else {
+			ansi.Printf("@Y{~ policy %s}\n", name)
+		}
+		diff(remote, local[name])
+		fmt.Printf("\n")
+		changed++
+
+		if !dryRun {
+			if err := v.SetPolicy(ctx, name, local[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if prune {
+		existing, err := v.Policies(ctx)
+		if err != nil {
+			return err
+		}
+		for _, name := range existing {
+			if _, ok := local[name]; ok || name == "root" || name == "default" {
+				continue
+			}
+			ansi.Printf("@R{- policy %s}\n\n", name)
+			changed++
+
+			if !dryRun {
+				if err := v.DeletePolicy(ctx, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	policies := "policies"
+	if changed == 1 {
+		policies = "policy"
+	}
+	switch {
+	case changed == 0:
+		ansi.Fprintf(os.Stderr, "@G{All policies are up to date}\n")
+	case dryRun:
+		ansi.Fprintf(os.Stderr, "@Y{%d %s would be changed} (dry run; nothing was written)\n", changed, policies)
+	default:
+		ansi.Fprintf(os.Stderr, "@G{%d %s changed}\n", changed, policies)
+	}
+	return nil
+}
+
+// mountOptions sets up the options shared by the mount and tune
+// commands, and returns a function that turns them into a MountConfig,
+// once they have been parsed.
+func mountOptions() func() (vault.MountConfig, error) {
+	version := getopt.StringLong("kv-version", 0, "", "KV version (1 or 2) of a kv mount")
+	description := getopt.StringLong("description", 0, "", "Human-friendly description of the mount")
+	defaultTTL := getopt.StringLong("default-lease-ttl", 0, "", "Default lease TTL for secrets from the mount")
+	maxTTL := getopt.StringLong("max-lease-ttl", 0, "", "Maximum lease TTL for secrets from the mount")
+
+	return func() (vault.MountConfig, error) {
+		c := vault.MountConfig{
+			Description:     *description,
+			DefaultLeaseTTL: *defaultTTL,
+			MaxLeaseTTL:     *maxTTL,
+		}
+		switch *version {
+		case "":
+			break
+		case "1", "2":
+			c.Options = map[string]string{"version": *version}
+		default:
+			return c, fmt.Errorf("invalid --kv-version '%s' (must be 1 or 2)", *version)
+		}
+		return c, nil
+	}
+}
+
+// promptKeys prompts for unseal keys, handing each one to submit, until
+// submit reports that enough keys have been provided (in which case it
+// returns true), or until no key is given (leaving the operation to be
+// finished later, possibly by someone else).  submit returns how many
+// keys have been provided so far.
+func promptKeys(progress, required int, submit func(key string) (int, bool, error)) (bool, error) {
+	for {
+		key := prompt.Secure("Unseal key %d of %d: ", progress+1, required)
+		if key == "" {
+			ansi.Fprintf(os.Stderr, "@Y{%d of %d unseal keys provided so far}; run this again to provide the rest\n", progress, required)
+			return false, nil
+		}
 
-	if *recursiveMode && !*forceMode {
-		fmt.Printf("Are you sure you wish to recursively %s %s? (y/n) ", cmd, strings.Join(args, " "))
-		reader := bufio.NewReader(os.Stdin)
-		y, _ := reader.ReadString('\n')
-		y = strings.TrimSpace(y)
-		if y != "y" && y != "yes" {
-			fmt.Printf("Aborting...\n")
-			os.Exit(0)
+		var done bool
+		var err error
+		if progress, done, err = submit(key); err != nil || done {
+			return done, err
 		}
 	}
+}
+
+// printStatus prints the seal status (and HA status, if unsealed) of
+// a Vault, for the status command.
+func printStatus(v *vault.Vault) error {
+	s, err := v.SealStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !s.Initialized {
+		ansi.Printf("      @B{initialized}  @R{no}\n")
+		return nil
+	}
+	if s.Sealed {
+		ansi.Printf("      @B{sealed}       @R{yes} (%d of %d unseal keys provided)\n", s.Progress, s.Threshold)
+	} else {
+		ansi.Printf("      @B{sealed}       @G{no}\n")
+	}
+	ansi.Printf("      @B{version}      %s\n", s.Version)
+	if s.ClusterName != "" {
+		ansi.Printf("      @B{cluster}      %s\n", s.ClusterName)
+	}
+	if s.Sealed {
+		return nil
+	}
+
+	l, err := v.LeaderStatus(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !l.HAEnabled:
+		ansi.Printf("      @B{ha}           disabled\n")
+	case l.IsSelf:
+		ansi.Printf("      @B{ha}           @G{active}\n")
+	default:
+		ansi.Printf("      @B{ha}           @Y{standby} (the active node is @C{%s})\n", l.LeaderAddress)
+	}
+	return nil
+}
+
+// readInput reads the contents of the file named in args, or standard
+// input if there isn't one (or it is "-").
+func readInput(args []string) ([]byte, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(args[0])
+}
+
+// confirm asks the user whether or not to proceed with some destructive
+// operation, and exits if they don't answer in the affirmative.
+func confirm(format string, args ...interface{}) {
+	fmt.Printf(format+" (y/n) ", args...)
+	reader := bufio.NewReader(os.Stdin)
+	y, _ := reader.ReadString('\n')
+	y = strings.TrimSpace(y)
+	if y != "y" && y != "yes" {
+		fmt.Printf("Aborting...\n")
+		os.Exit(0)
+	}
+}
+
+func shouldRecurse(cmd string, args ...string) (bool, []string) {
+	var recursiveMode *bool
 
+	getopt.BoolLong("force", 'f', "Disable confirmation prompting, and capability checks before recursing")
+	recursiveMode = getopt.BoolLong("recursive", 'R', "Enable recursion")
+
+	args = parseOptions(cmd, args...)
 	return *recursiveMode, args
 }
+
+// confirmRecurse gets a recursive operation ready to start, first by
+// running its pre-flight check, so that it won't fail part of the way
+// through, and then by asking the user to confirm it.  With --force,
+// neither happens.
+func confirmRecurse(cmd string, args []string, check func() error) error {
+	if getopt.Lookup("force").Seen() {
+		return nil
+	}
+	if err := preflight(check()); err != nil {
+		return err
+	}
+	confirm("Are you sure you wish to recursively %s %s?", cmd, strings.Join(args, " "))
+	return nil
+}
+
+// preflight explains why a recursive operation is refusing to start,
+// given the error from its pre-flight check (if any).
+func preflight(err error) error {
+	if err == nil {
+		return nil
+	}
+	e, ok := err.(*vault.CapabilityError)
+	if !ok {
+		return err
+	}
+
+	paths := e.Paths()
+	width := 0
+	for _, path := range paths {
+		if len(path) > width {
+			width = len(path)
+		}
+	}
+	for _, path := range paths {
+		ansi.Fprintf(os.Stderr, "  @R{%s}  needs %s\n", fmt.Sprintf("%-*s", width, path), e.Missing[path])
+	}
+	return fmt.Errorf("%s; nothing was changed (use --force to try anyway)", e)
+}
+
+// parseVersions converts a list of version numbers, as given on the
+// command line, into integers.
+func parseVersions(l []string) ([]int, error) {
+	var versions []int
+	for _, s := range l {
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid version '%s'", s)
+		}
+		versions = append(versions, int(n))
+	}
+	return versions, nil
+}
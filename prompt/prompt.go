@@ -10,15 +10,19 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// stdin is shared, so that successive prompts don't lose any input that
+// was buffered up while reading the answer to the previous one.
+var stdin = bufio.NewReader(os.Stdin)
+
 func Normal(label string, args ...interface{}) string {
 	ansi.Fprintf(os.Stderr, label, args...)
-	s, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	s, _ := stdin.ReadString('\n')
 	return strings.TrimSuffix(s, "\n")
 }
 
 func Secure(label string, args ...interface{}) string {
 	if !isatty.IsTerminal(os.Stdin.Fd()) {
-		s, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		s, _ := stdin.ReadString('\n')
 		return strings.TrimSuffix(s, "\n")
 	}
 
@@ -1,49 +1,120 @@
 package rc
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/ghodss/yaml"
 )
 
 type Config struct {
-	Current string                 `yaml:"current"`
-	Targets map[string]interface{} `yaml:"targets"`
-	Aliases map[string]string      `yaml:"aliases"`
+	Current string            `yaml:"current"`
+	Targets map[string]Target `yaml:"targets"`
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// A Target holds the authentication token and any other settings for
+// a single Vault, identified by its URL.
+type Target struct {
+	Token     string `json:"token,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+
+	/* how to retry requests that fail for transient reasons;
+	   see $VAULT_MAX_RETRIES, $SAFE_RETRY_WAIT and $SAFE_RETRY_MAX_WAIT */
+	MaxRetries   *int   `json:"max_retries,omitempty"`
+	RetryWait    string `json:"retry_wait,omitempty"`
+	RetryMaxWait string `json:"retry_max_wait,omitempty"`
+
+	/* whether or not to follow HA redirects to other hosts,
+	   sending along the Vault token; see $SAFE_TRUST_REDIRECTS */
+	TrustRedirects bool `json:"trust_redirects,omitempty"`
+
+	/* how long before the token expires to start warning about it,
+	   and whether to renew it instead; see $SAFE_TOKEN_WARN and
+	   $SAFE_TOKEN_RENEW */
+	TokenWarn string `json:"token_warn,omitempty"`
+	AutoRenew bool   `json:"auto_renew,omitempty"`
+
+	TLS
+}
+
+// TLS holds the settings for verifying a Vault's certificate, and for
+// presenting a client certificate to it.  Each setting corresponds to
+// one of the $VAULT_CACERT, $VAULT_CAPATH, $VAULT_CLIENT_CERT,
+// $VAULT_CLIENT_KEY and $VAULT_TLS_SERVER_NAME environment variables.
+type TLS struct {
+	CACert     string `json:"ca_cert,omitempty"`
+	CAPath     string `json:"ca_path,omitempty"`
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+	ServerName string `json:"tls_server_name,omitempty"`
+}
+
+// UnmarshalJSON accepts both the full Target representation and, as
+// written by older versions of safe, a bare token string.
+func (t *Target) UnmarshalJSON(b []byte) error {
+	var token string
+	if err := json.Unmarshal(b, &token); err == nil {
+		t.Token = token
+		return nil
+	}
+
+	type target Target
+	return json.Unmarshal(b, (*target)(t))
+}
+
+// MarshalJSON writes out Targets that have nothing configured besides
+// their token as just the token, so that ~/.saferc stays readable by
+// older versions of safe.
+func (t Target) MarshalJSON() ([]byte, error) {
+	type target Target
+	full, err := json.Marshal(target(t))
+	if err != nil {
+		return nil, err
+	}
+	bare, err := json.Marshal(target{Token: t.Token})
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(full, bare) {
+		return json.Marshal(t.Token)
+	}
+	return full, nil
 }
 
 func saferc() string {
 	return fmt.Sprintf("%s/.saferc", os.Getenv("HOME"))
 }
 
+func vaultToken() string {
+	return fmt.Sprintf("%s/.vault-token", os.Getenv("HOME"))
+}
+
 func svtoken() string {
 	return fmt.Sprintf("%s/.svtoken", os.Getenv("HOME"))
 }
 
-func (c *Config) credentials() (string, string, error) {
+func (c *Config) credentials() (string, *Target, error) {
 	if c.Current == "" {
-		return "", "", nil
+		return "", nil, nil
 	}
 
 	url, ok := c.Aliases[c.Current]
 	if !ok {
-		return "", "", fmt.Errorf("Current target vault '%s' not found in ~/.saferc", c.Current)
+		return "", nil, fmt.Errorf("Current target vault '%s' not found in ~/.saferc", c.Current)
 	}
 
 	t, ok := c.Targets[url]
 	if !ok {
-		return "", "", fmt.Errorf("Current target vault '%s' not found in ~/.saferc", c.Current)
+		return "", nil, fmt.Errorf("Current target vault '%s' not found in ~/.saferc", c.Current)
 	}
 
-	token := ""
-	if t != nil {
-		token = t.(string)
-	}
-
-	return url, token, nil
+	return url, &t, nil
 }
 
 func Apply() Config {
@@ -69,16 +140,20 @@ func (c *Config) Write() error {
 		return err
 	}
 
-	url, token, err := c.credentials()
+	url, t, err := c.credentials()
 	if err != nil {
 		return err
 	}
+	if t == nil {
+		t = &Target{}
+	}
 
 	b, err = yaml.Marshal(
 		struct {
-			URL   string `json:"vault"`
-			Token string `json:"token"`
-		}{url, token})
+			URL       string `json:"vault"`
+			Token     string `json:"token"`
+			Namespace string `json:"namespace,omitempty"`
+		}{url, t.Token, t.Namespace})
 	if err != nil {
 		return err
 	}
@@ -86,19 +161,39 @@ func (c *Config) Write() error {
 	return ioutil.WriteFile(svtoken(), b, 0600)
 }
 
+// environ is the environment as it was before the settings of any
+// target were applied to it.  Each target's settings are applied to a
+// fresh copy of it, so that none of them leak into the next target's.
+var environ []string
+
+// reset puts the environment back the way it was before the settings
+// of any target were applied to it.
+func reset() {
+	if environ == nil {
+		environ = os.Environ()
+		return
+	}
+	os.Clearenv()
+	for _, e := range environ {
+		if i := strings.Index(e, "="); i > 0 {
+			os.Setenv(e[:i], e[i+1:])
+		}
+	}
+}
+
 func (c *Config) Apply() error {
-	url, token, err := c.credentials()
+	url, t, err := c.credentials()
 	if err != nil {
 		return err
 	}
 
+	reset()
+
 	if url != "" {
-		os.Setenv("VAULT_ADDR", url)
-		os.Setenv("VAULT_TOKEN", token)
+		t.apply(url)
 	} else {
 		if os.Getenv("VAULT_TOKEN") == "" {
-			tokenFile := fmt.Sprintf("%s/.vault-token", os.Getenv("HOME"))
-			b, err := ioutil.ReadFile(tokenFile)
+			b, err := ioutil.ReadFile(vaultToken())
 			if err == nil {
 				os.Setenv("VAULT_TOKEN", strings.TrimSpace(string(b)))
 			}
@@ -107,6 +202,61 @@ func (c *Config) Apply() error {
 	return nil
 }
 
+// WithTarget runs f with the environment set up for talking to the
+// Vault at the given URL, the same way that Apply does for the current
+// target, and then sets it back up for the current target.
+func (c *Config) WithTarget(url string, f func()) error {
+	t, ok := c.Targets[url]
+	if !ok {
+		return fmt.Errorf("Unknown target '%s'", url)
+	}
+	reset()
+	t.apply(url)
+	f()
+	return c.Apply()
+}
+
+func (t *Target) apply(url string) {
+	os.Setenv("VAULT_ADDR", url)
+	os.Setenv("VAULT_TOKEN", t.Token)
+	if t.Namespace != "" {
+		os.Setenv("VAULT_NAMESPACE", t.Namespace)
+	}
+	if t.MaxRetries != nil {
+		os.Setenv("VAULT_MAX_RETRIES", fmt.Sprintf("%d", *t.MaxRetries))
+	}
+	if t.RetryWait != "" {
+		os.Setenv("SAFE_RETRY_WAIT", t.RetryWait)
+	}
+	if t.RetryMaxWait != "" {
+		os.Setenv("SAFE_RETRY_MAX_WAIT", t.RetryMaxWait)
+	}
+	if t.TrustRedirects {
+		os.Setenv("SAFE_TRUST_REDIRECTS", "1")
+	}
+	if t.TokenWarn != "" {
+		os.Setenv("SAFE_TOKEN_WARN", t.TokenWarn)
+	}
+	if t.AutoRenew {
+		os.Setenv("SAFE_TOKEN_RENEW", "1")
+	}
+	if t.CACert != "" {
+		os.Setenv("VAULT_CACERT", t.CACert)
+	}
+	if t.CAPath != "" {
+		os.Setenv("VAULT_CAPATH", t.CAPath)
+	}
+	if t.ClientCert != "" {
+		os.Setenv("VAULT_CLIENT_CERT", t.ClientCert)
+	}
+	if t.ClientKey != "" {
+		os.Setenv("VAULT_CLIENT_KEY", t.ClientKey)
+	}
+	if t.ServerName != "" {
+		os.Setenv("VAULT_TLS_SERVER_NAME", t.ServerName)
+	}
+}
+
 func (c *Config) SetCurrent(alias string) error {
 	if _, ok := c.Aliases[alias]; ok {
 		c.Current = alias
@@ -120,12 +270,12 @@ func (c *Config) SetTarget(alias, url string) error {
 		c.Aliases = make(map[string]string)
 	}
 	if c.Targets == nil {
-		c.Targets = make(map[string]interface{})
+		c.Targets = make(map[string]Target)
 	}
 	c.Aliases[alias] = url
 	c.Current = alias
 	if _, ok := c.Targets[url]; !ok {
-		c.Targets[url] = nil
+		c.Targets[url] = Target{}
 	}
 	return nil
 }
@@ -138,10 +288,102 @@ func (c *Config) SetToken(token string) error {
 	if !ok {
 		return fmt.Errorf("Unknown target '%s'", c.Current)
 	}
-	c.Targets[url] = token
+	t := c.Targets[url]
+	t.Token = token
+	c.Targets[url] = t
+	return nil
+}
+
+// ClearToken forgets the token for the Vault at the given URL.
+func (c *Config) ClearToken(url string) error {
+	t, ok := c.Targets[url]
+	if !ok {
+		return fmt.Errorf("Unknown target '%s'", url)
+	}
+	t.Token = ""
+	c.Targets[url] = t
+	return nil
+}
+
+// ForgetVaultToken removes ~/.vault-token (as written by the vault CLI)
+// if it holds the given token, so that it doesn't hang on to a token
+// that is no longer valid.
+func ForgetVaultToken(token string) error {
+	b, err := ioutil.ReadFile(vaultToken())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if token == "" || strings.TrimSpace(string(b)) != token {
+		return nil
+	}
+	return os.Remove(vaultToken())
+}
+
+// SetNamespace sets the Vault Enterprise namespace to use for the
+// currently targeted Vault.  An empty namespace clears it.
+func (c *Config) SetNamespace(namespace string) error {
+	if c.Current == "" {
+		return fmt.Errorf("No target selected")
+	}
+	url, ok := c.Aliases[c.Current]
+	if !ok {
+		return fmt.Errorf("Unknown target '%s'", c.Current)
+	}
+	t := c.Targets[url]
+	t.Namespace = namespace
+	c.Targets[url] = t
+	return nil
+}
+
+// SetTLS replaces the TLS settings for the currently targeted Vault.
+func (c *Config) SetTLS(tls TLS) error {
+	if c.Current == "" {
+		return fmt.Errorf("No target selected")
+	}
+	url, ok := c.Aliases[c.Current]
+	if !ok {
+		return fmt.Errorf("Unknown target '%s'", c.Current)
+	}
+	t := c.Targets[url]
+	t.TLS = tls
+	c.Targets[url] = t
 	return nil
 }
 
+// Target returns the settings for the Vault that the given alias
+// refers to, or nil if there are none.
+func (c *Config) Target(alias string) *Target {
+	if url, ok := c.Aliases[alias]; ok {
+		if t, ok := c.Targets[url]; ok {
+			return &t
+		}
+	}
+	return nil
+}
+
+// Namespace returns the Vault Enterprise namespace configured for the
+// currently targeted Vault, if any.
+func (c *Config) Namespace() string {
+	if t := c.Target(c.Current); t != nil {
+		return t.Namespace
+	}
+	return ""
+}
+
+// URLs returns the URLs of all the Vaults that have been targeted,
+// in order.
+func (c *Config) URLs() []string {
+	var urls []string
+	for url := range c.Targets {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
 func (c *Config) URL() string {
 	if url, ok := c.Aliases[c.Current]; ok {
 		return url
@@ -0,0 +1,167 @@
+package rc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/starkandwayne/safe/vault"
+)
+
+// clearEnv unsets everything that a target's settings can set, and
+// forgets the environment that they were first applied to.
+func clearEnv() {
+	for _, name := range []string{
+		"VAULT_ADDR", "VAULT_TOKEN", "VAULT_NAMESPACE",
+		"VAULT_MAX_RETRIES", "SAFE_RETRY_WAIT", "SAFE_RETRY_MAX_WAIT",
+		"SAFE_TRUST_REDIRECTS", "SAFE_TOKEN_WARN", "SAFE_TOKEN_RENEW",
+		"VAULT_CACERT", "VAULT_CAPATH", "VAULT_CLIENT_CERT", "VAULT_CLIENT_KEY", "VAULT_TLS_SERVER_NAME",
+	} {
+		os.Unsetenv(name)
+	}
+	environ = nil
+}
+
+func TestWithTarget(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+	/* set by the user, rather than by any target */
+	os.Setenv("VAULT_CLIENT_KEY", "/home/me/key.pem")
+
+	retries := 5
+	cfg := Config{
+		Current: "a",
+		Aliases: map[string]string{
+			"a": "https://a.example.com",
+			"b": "https://b.example.com",
+		},
+		Targets: map[string]Target{
+			"https://a.example.com": {
+				Token:          "token-a",
+				Namespace:      "ns-a",
+				MaxRetries:     &retries,
+				TrustRedirects: true,
+				AutoRenew:      true,
+				TLS:            TLS{CACert: "/a/ca.pem", ClientCert: "/a/cert.pem", ClientKey: "/a/key.pem"},
+			},
+			"https://b.example.com": {
+				Token: "token-b",
+				TLS:   TLS{CAPath: "/b/certs"},
+			},
+		},
+	}
+
+	a := map[string]string{
+		"VAULT_ADDR":           "https://a.example.com",
+		"VAULT_TOKEN":          "token-a",
+		"VAULT_NAMESPACE":      "ns-a",
+		"VAULT_MAX_RETRIES":    "5",
+		"SAFE_TRUST_REDIRECTS": "1",
+		"SAFE_TOKEN_RENEW":     "1",
+		"VAULT_CACERT":         "/a/ca.pem",
+		"VAULT_CAPATH":         "",
+		"VAULT_CLIENT_CERT":    "/a/cert.pem",
+		"VAULT_CLIENT_KEY":     "/a/key.pem",
+	}
+	b := map[string]string{
+		"VAULT_ADDR":           "https://b.example.com",
+		"VAULT_TOKEN":          "token-b",
+		"VAULT_NAMESPACE":      "",
+		"VAULT_MAX_RETRIES":    "",
+		"SAFE_TRUST_REDIRECTS": "",
+		"SAFE_TOKEN_RENEW":     "",
+		"VAULT_CACERT":         "",
+		"VAULT_CAPATH":         "/b/certs",
+		"VAULT_CLIENT_CERT":    "",
+		"VAULT_CLIENT_KEY":     "/home/me/key.pem",
+	}
+	check := func(when string, want map[string]string) {
+		for name, value := range want {
+			if got := os.Getenv(name); got != value {
+				t.Errorf("%s: $%s is '%s', wanted '%s'", when, name, got, value)
+			}
+		}
+	}
+
+	if err := cfg.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	check("current target", a)
+
+	for _, url := range []string{"https://b.example.com", "https://a.example.com", "https://b.example.com"} {
+		err := cfg.WithTarget(url, func() {
+			if url == "https://a.example.com" {
+				check("with target a", a)
+			} else {
+				check("with target b", b)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("after "+url, a)
+	}
+
+	if err := cfg.WithTarget("https://c.example.com", func() {
+		t.Errorf("ran with an unknown target")
+	}); err == nil {
+		t.Errorf("no error for an unknown target")
+	}
+}
+
+// TestWithTargetHeaders checks what each Vault actually gets sent when
+// looping over every target (as status --all does).
+func TestWithTargetHeaders(t *testing.T) {
+	namespaces := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespaces[r.Host] = r.Header.Get("X-Vault-Namespace")
+		w.Write([]byte(`{"sealed":false,"initialized":true,"t":1,"n":1}`))
+	}))
+	defer srv.Close()
+
+	clearEnv()
+	defer clearEnv()
+
+	/* the same Vault, under two names */
+	other := "http://localhost" + srv.URL[len("http://127.0.0.1"):]
+	cfg := Config{
+		Current: "a",
+		Aliases: map[string]string{"a": srv.URL, "b": other},
+		Targets: map[string]Target{
+			srv.URL: {Token: "token-a", Namespace: "ns-a"},
+			other:   {Token: "token-b"},
+		},
+	}
+	if err := cfg.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{srv.URL, other} {
+		err := cfg.WithTarget(url, func() {
+			v, err := vault.NewUnauthenticatedVault(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := v.SealStatus(context.Background()); err != nil {
+				t.Errorf("%s: %s", url, err)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		srv.URL[len("http://"):]: "ns-a",
+		other[len("http://"):]:   "",
+	}
+	for host, ns := range want {
+		if got, ok := namespaces[host]; !ok {
+			t.Errorf("%s was never asked for its status", host)
+		} else if got != ns {
+			t.Errorf("%s was sent namespace '%s', wanted '%s'", host, got, ns)
+		}
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-func Signals() {
+// Signals restores the terminal and exits on SIGTERM and SIGQUIT.
+//
+// SIGINT calls cancel instead, so that the running command can abandon
+// its requests and report on what it did (and did not) get done.  If
+// the command hasn't exited shortly thereafter (i.e. because it is
+// waiting on a prompt), or another SIGINT arrives, safe exits anyway.
+func Signals(cancel func()) {
 	prev, err := terminal.GetState(int(os.Stdin.Fd()))
 	if err != nil {
 		prev = nil
@@ -16,8 +23,18 @@ func Signals() {
 
 	s := make(chan os.Signal, 1)
 	signal.Notify(s, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-	for _ = range s {
-		terminal.Restore(int(os.Stdin.Fd()), prev)
-		os.Exit(1)
+	cancelled := false
+	for sig := range s {
+		if prev != nil {
+			terminal.Restore(int(os.Stdin.Fd()), prev)
+		}
+		if sig != syscall.SIGINT || cancelled {
+			os.Exit(1)
+		}
+		cancelled = true
+		cancel()
+		time.AfterFunc(time.Second, func() {
+			os.Exit(1)
+		})
 	}
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/starkandwayne/goutils/ansi"
 	"github.com/starkandwayne/safe/prompt"
+	"github.com/starkandwayne/safe/vault"
 )
 
 func fail(err error) {
@@ -17,8 +18,24 @@ func fail(err error) {
 	}
 }
 
-func keyPrompt(key string, confirm bool) (string, string, error) {
-	if strings.Index(key, "=") >= 0 {
+// keyPrompt parses a key[=value], key@file or key:=json argument into
+// a key and its value, prompting for the value if it isn't given.  Values
+// given with := are parsed as JSON, so that they can be numbers, booleans,
+// lists or objects, and not just strings.
+func keyPrompt(key string, confirm bool) (string, interface{}, error) {
+	if i := strings.Index(key, ":="); i >= 0 && i < strings.Index(key, "=") {
+		k, raw := key[:i], key[i+2:]
+		if raw == "" {
+			raw = pr(k, confirm)
+		}
+		value, err := vault.ParseJSON(raw)
+		if err != nil {
+			return k, nil, fmt.Errorf("Invalid JSON value for %s: %s", k, err)
+		}
+		ansi.Fprintf(os.Stderr, "%s: @G{%s}\n", k, raw)
+		return k, value, nil
+
+	} else if strings.Index(key, "=") >= 0 {
 		l := strings.SplitN(key, "=", 2)
 		if l[1] == "" {
 			l[1] = pr(l[0], confirm)
@@ -0,0 +1,208 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A CapabilityError is returned by PreflightDeleteTree and
+// PreflightMoveCopyTree when the token lacks the capabilities needed on
+// some of the paths that the operation would touch.  Missing maps each
+// of those paths to what it lacks (i.e. "delete").
+type CapabilityError struct {
+	Op      string
+	Missing map[string]string
+}
+
+func (e *CapabilityError) Error() string {
+	n := len(e.Missing)
+	if n == 1 {
+		return fmt.Sprintf("your token lacks the capabilities needed to %s 1 path", e.Op)
+	}
+	return fmt.Sprintf("your token lacks the capabilities needed to %s %d paths", e.Op, n)
+}
+
+// Paths returns the paths that the token lacks capabilities on, sorted.
+func (e *CapabilityError) Paths() []string {
+	l := make([]string, 0, len(e.Missing))
+	for path := range e.Missing {
+		l = append(l, path)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Capabilities returns the capabilities (i.e. "read", "update", or
+// "deny") that the token the Vault is being accessed with has on each
+// of the given secret paths.  On KV v2 mounts, these are the
+// capabilities on the secret itself (its data/ path).
+func (v *Vault) Capabilities(ctx context.Context, paths []string) (map[string][]string, error) {
+	api := make([]string, len(paths))
+	for i, path := range paths {
+		api[i] = v.kvPath(ctx, strings.Trim(path, "/"), "data")
+	}
+	caps, err := v.capabilities(ctx, api)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]string)
+	for i, path := range paths {
+		out[path] = caps[api[i]]
+	}
+	return out, nil
+}
+
+// capabilities looks up the capabilities that the token has on each of
+// the given API paths, a batch at a time.
+func (v *Vault) capabilities(ctx context.Context, paths []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	for len(paths) > 0 {
+		batch := paths
+		if len(batch) > 100 {
+			batch = batch[:100]
+		}
+		paths = paths[len(batch):]
+
+		var r map[string]interface{}
+		in := struct {
+			Paths []string `json:"paths"`
+		}{batch}
+		if err := v.sys(ctx, "POST", "capabilities-self", in, &r); err != nil {
+			return nil, err
+		}
+		/* newer Vaults also put everything under "data" */
+		if data, ok := r["data"].(map[string]interface{}); ok {
+			r = data
+		}
+
+		for _, path := range batch {
+			l, ok := r[path].([]interface{})
+			if !ok && len(batch) == 1 {
+				l, ok = r["capabilities"].([]interface{})
+			}
+			if !ok {
+				return nil, fmt.Errorf("malformed response from vault (no capabilities for %s)", path)
+			}
+			caps := []string{}
+			for _, c := range l {
+				if s, ok := c.(string); ok {
+					caps = append(caps, s)
+				}
+			}
+			out[path] = caps
+		}
+	}
+	return out, nil
+}
+
+// A requirement is a set of capabilities on a secret, any one of which
+// is enough for whatever is going to be done to it.
+type requirement struct {
+	secret string
+	caps   []string
+}
+
+// preflight checks each of the requirements, on the given endpoint (see
+// kvPath), returning a *CapabilityError for those the token doesn't meet.
+func (v *Vault) preflight(ctx context.Context, op, endpoint string, reqs []requirement) error {
+	var paths []string
+	api := make(map[string]string)
+	for _, req := range reqs {
+		if _, ok := api[req.secret]; !ok {
+			api[req.secret] = v.kvPath(ctx, req.secret, endpoint)
+			paths = append(paths, api[req.secret])
+		}
+	}
+	caps, err := v.capabilities(ctx, paths)
+	if err != nil {
+		return fmt.Errorf("unable to check the capabilities of your token: %s", err)
+	}
+
+	missing := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, req := range reqs {
+		lacks := strings.Join(req.caps, " or ")
+		if seen[req.secret+"\n"+lacks] || hasAny(caps[api[req.secret]], req.caps) {
+			continue
+		}
+		seen[req.secret+"\n"+lacks] = true
+		if missing[req.secret] != "" {
+			lacks = missing[req.secret] + ", " + lacks
+		}
+		missing[req.secret] = lacks
+	}
+	if len(missing) > 0 {
+		return &CapabilityError{Op: op, Missing: missing}
+	}
+	return nil
+}
+
+func hasAny(caps, want []string) bool {
+	for _, c := range caps {
+		if c == "root" {
+			return true
+		}
+		for _, w := range want {
+			if c == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PreflightDeleteTree checks that the token can delete (or, with
+// destroy, destroy) every secret that DeleteTree would, returning a
+// *CapabilityError listing those that it can't, so that the tree isn't
+// left half-deleted.
+func (v *Vault) PreflightDeleteTree(ctx context.Context, root string, destroy bool) error {
+	tree, err := v.Tree(ctx, root, TreeOptions{})
+	if err != nil {
+		return err
+	}
+
+	op, endpoint := "delete", "data"
+	if destroy {
+		op, endpoint = "destroy", "metadata"
+	}
+	var reqs []requirement
+	for _, path := range append(tree.Paths("/"), root) {
+		reqs = append(reqs, requirement{path, []string{"delete"}})
+	}
+	return v.preflight(ctx, op, endpoint, reqs)
+}
+
+// PreflightMoveCopyTree checks that the token can read (and, to move
+// them, delete) every secret that MoveCopyTree would, and write each to
+// its new path, returning a *CapabilityError listing those that it
+// can't, so that the tree isn't left half-moved (or half-copied).
+func (v *Vault) PreflightMoveCopyTree(ctx context.Context, oldRoot, newRoot string, move bool) error {
+	tree, err := v.Tree(ctx, oldRoot, TreeOptions{})
+	if err != nil {
+		return err
+	}
+	paths := tree.Paths("/")
+	if _, err := v.Read(ctx, oldRoot); err != NotFound {
+		paths = append(paths, oldRoot)
+	}
+
+	op := "copy"
+	if move {
+		op = "move"
+	}
+	var reqs []requirement
+	for _, path := range paths {
+		reqs = append(reqs, requirement{path, []string{"read"}})
+		if move {
+			reqs = append(reqs, requirement{path, []string{"delete"}})
+		}
+		/* whether writing needs create or update depends on whether
+		   there is something there already */
+		newPath := strings.Replace(path, oldRoot, newRoot, 1)
+		reqs = append(reqs, requirement{newPath, []string{"create", "update"}})
+	}
+	return v.preflight(ctx, op, "data", reqs)
+}
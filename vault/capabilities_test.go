@@ -0,0 +1,223 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// kvVault returns a Vault backed by a fake KV v1 mount at secret/,
+// holding the given secrets, on which the token has whatever
+// capabilities caps says it has on each path.  It also returns every
+// request that was made of the fake Vault, as "METHOD path".
+func kvVault(secrets []string, caps func(path string) []string) (*Vault, *[]string, func()) {
+	var lock sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		lock.Lock()
+		requests = append(requests, r.Method+" "+path)
+		lock.Unlock()
+
+		switch {
+		case path == "sys/capabilities-self":
+			var in struct {
+				Paths []string `json:"paths"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			out := make(map[string][]string)
+			for _, p := range in.Paths {
+				out[p] = caps(p)
+			}
+			json.NewEncoder(w).Encode(out)
+
+		case r.URL.Query().Get("list") != "":
+			seen := make(map[string]bool)
+			var keys []string
+			for _, s := range secrets {
+				if !strings.HasPrefix(s, path+"/") {
+					continue
+				}
+				key := strings.TrimPrefix(s, path+"/")
+				if i := strings.Index(key, "/"); i >= 0 {
+					key = key[:i+1]
+				}
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(404)
+				w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+
+		default:
+			for _, s := range secrets {
+				if s == path {
+					w.Write([]byte(`{"data":{"k":"v"}}`))
+					return
+				}
+			}
+			w.WriteHeader(404)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		mounts: map[string]mount{"secret/": {Type: "kv", Options: map[string]string{"version": "1"}}},
+	}
+	return v, &requests, srv.Close
+}
+
+func TestPreflightDeleteTree(t *testing.T) {
+	secrets := []string{"secret/app/a", "secret/app/db/password", "secret/app/locked/key", "secret/app/hidden"}
+	caps := func(path string) []string {
+		switch {
+		case strings.Contains(path, "hidden"):
+			return []string{"deny"}
+		case strings.Contains(path, "locked"):
+			return []string{"read", "list"}
+		case strings.HasPrefix(path, "secret/app/db/"):
+			return []string{"root"}
+		}
+		return []string{"create", "read", "update", "delete", "list"}
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		missing map[string]string
+	}{
+		{"everything allowed", "secret/app/db", nil},
+		{"some denied", "secret/app", map[string]string{
+			"secret/app/hidden":     "delete",
+			"secret/app/locked/key": "delete",
+		}},
+	}
+
+	for _, test := range tests {
+		v, _, done := kvVault(secrets, caps)
+		err := v.PreflightDeleteTree(context.Background(), test.root, false)
+		done()
+
+		if test.missing == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err)
+			}
+			continue
+		}
+		e, ok := err.(*CapabilityError)
+		if !ok {
+			t.Errorf("%s: got %v, wanted a *CapabilityError", test.name, err)
+			continue
+		}
+		if e.Op != "delete" || !reflect.DeepEqual(e.Missing, test.missing) {
+			t.Errorf("%s: %s is missing %v, wanted delete missing %v", test.name, e.Op, e.Missing, test.missing)
+		}
+	}
+}
+
+func TestPreflightMoveCopyTree(t *testing.T) {
+	secrets := []string{"secret/old/a", "secret/old/b", "secret/old/locked"}
+	caps := func(path string) []string {
+		switch {
+		case path == "secret/old/locked":
+			return []string{"read", "list"}
+		case strings.HasPrefix(path, "secret/new/"):
+			return []string{"create"}
+		case strings.HasPrefix(path, "secret/ro/"):
+			return []string{"read"}
+		}
+		return []string{"read", "update", "delete"}
+	}
+
+	tests := []struct {
+		name    string
+		newRoot string
+		move    bool
+		op      string
+		missing map[string]string
+	}{
+		{"copy", "secret/new", false, "copy", nil},
+		{"move", "secret/new", true, "move", map[string]string{
+			"secret/old/locked": "delete",
+		}},
+		{"copy to somewhere read-only", "secret/ro", false, "copy", map[string]string{
+			"secret/ro/a":      "create or update",
+			"secret/ro/b":      "create or update",
+			"secret/ro/locked": "create or update",
+		}},
+		{"move to somewhere read-only", "secret/ro", true, "move", map[string]string{
+			"secret/old/locked": "delete",
+			"secret/ro/a":       "create or update",
+			"secret/ro/b":       "create or update",
+			"secret/ro/locked":  "create or update",
+		}},
+	}
+
+	for _, test := range tests {
+		v, requests, done := kvVault(secrets, caps)
+		err := v.PreflightMoveCopyTree(context.Background(), "secret/old", test.newRoot, test.move)
+		done()
+
+		for _, r := range *requests {
+			if !strings.HasPrefix(r, "GET ") && r != "POST sys/capabilities-self" {
+				t.Errorf("%s: the pre-flight check made a change (%s)", test.name, r)
+			}
+		}
+		if test.missing == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err)
+			}
+			continue
+		}
+		e, ok := err.(*CapabilityError)
+		if !ok {
+			t.Errorf("%s: got %v, wanted a *CapabilityError", test.name, err)
+			continue
+		}
+		if e.Op != test.op || !reflect.DeepEqual(e.Missing, test.missing) {
+			t.Errorf("%s: %s is missing %v, wanted %s missing %v", test.name, e.Op, e.Missing, test.op, test.missing)
+		}
+		paths := e.Paths()
+		if !sort.StringsAreSorted(paths) || len(paths) != len(test.missing) {
+			t.Errorf("%s: Paths() = %v", test.name, paths)
+		}
+	}
+}
+
+func TestPreflightCapabilitiesUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/sys/capabilities-self" {
+			w.WriteHeader(403)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": []string{"a"}}})
+	}))
+	defer srv.Close()
+
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		mounts: map[string]mount{"secret/": {Type: "kv"}},
+	}
+	err := v.PreflightDeleteTree(context.Background(), "secret/x", false)
+	if err == nil || !strings.Contains(err.Error(), "unable to check the capabilities") {
+		t.Errorf("got %v, wanted an error about checking capabilities", err)
+	}
+	if _, ok := err.(*CapabilityError); ok {
+		t.Errorf("a failure to look up capabilities was reported as the token lacking them")
+	}
+}
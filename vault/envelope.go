@@ -0,0 +1,340 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Sealed files start with a single header line,
+//
+//	$SAFE_SEALED;1;AES256_GCM;<backend>;<key>;<wrapped data key>
+//
+// followed by the base64-encoded nonce and ciphertext, wrapped at 64
+// columns.  The header is authenticated along with the ciphertext, so
+// that it can't be tampered with either.
+const (
+	sealedHeader  = "$SAFE_SEALED"
+	sealedVersion = "1"
+	sealedCipher  = "AES256_GCM"
+)
+
+// Sealed YAML documents keep their structure, with each value replaced
+// by SAFE[<base64-encoded nonce and ciphertext>], and the details of
+// the data key stored under a top-level safe_sealed key.  Each value is
+// authenticated along with its path (i.e. db.password), so that values
+// can't be moved around either.
+const (
+	sealedMetaKey     = "safe_sealed"
+	sealedValuePrefix = "SAFE["
+	sealedValueSuffix = "]"
+)
+
+type sealedMeta struct {
+	Version string `yaml:"version"`
+	Cipher  string `yaml:"cipher"`
+	Backend string `yaml:"backend"`
+	Key     string `yaml:"key"`
+	DataKey string `yaml:"data_key"`
+}
+
+// IsSealedFile returns true if data was sealed by SealFile (as opposed
+// to SealValues, or not at all).
+func IsSealedFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealedHeader+";"))
+}
+
+// SealFile encrypts data locally, with AES-GCM, using a new data key
+// from the named key of the transit backend mounted at backend (see
+// DataKey).  The wrapped data key is stored in the header of the sealed
+// file, so anyone who can decrypt with the transit key can UnsealFile it.
+func (v *Vault) SealFile(ctx context.Context, backend, key string, data []byte) ([]byte, error) {
+	backend = strings.Trim(backend, "/")
+	if strings.ContainsAny(backend+key, ";\n") {
+		return nil, fmt.Errorf("invalid transit backend or key name '%s/%s'", backend, key)
+	}
+
+	plainKey, wrappedKey, err := v.DataKey(ctx, backend, key)
+	if err != nil {
+		return nil, err
+	}
+	header := strings.Join([]string{sealedHeader, sealedVersion, sealedCipher, backend, key, wrappedKey}, ";")
+	sealed, err := seal(plainKey, data, []byte(header))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(header + "\n")
+	s := base64.StdEncoding.EncodeToString(sealed)
+	for len(s) > 64 {
+		out.WriteString(s[:64] + "\n")
+		s = s[64:]
+	}
+	out.WriteString(s + "\n")
+	return out.Bytes(), nil
+}
+
+// UnsealFile decrypts a file sealed by SealFile.
+func (v *Vault) UnsealFile(ctx context.Context, data []byte) ([]byte, error) {
+	if !IsSealedFile(data) {
+		return nil, fmt.Errorf("not a sealed file")
+	}
+	l := strings.SplitN(string(data), "\n", 2)
+	header, body := l[0], ""
+	if len(l) == 2 {
+		body = l[1]
+	}
+
+	fields := strings.Split(header, ";")
+	if len(fields) != 6 || fields[1] != sealedVersion || fields[2] != sealedCipher {
+		return nil, fmt.Errorf("unsupported sealed file format (%s)", header)
+	}
+	plainKey, err := v.unwrapDataKey(ctx, fields[3], fields[4], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt sealed file: %s", err)
+	}
+	return unseal(plainKey, sealed, []byte(header))
+}
+
+// SealValues encrypts each of the values in a YAML (or JSON) document
+// locally, like SealFile does for entire files, but leaves the keys and
+// the structure of the document alone, so that changes to it can still
+// be followed (i.e. in git).  The result is always YAML.
+func (v *Vault) SealValues(ctx context.Context, backend, key string, data []byte) ([]byte, error) {
+	if multiDocument(data) {
+		return nil, fmt.Errorf("only single YAML documents can have their values sealed (this file has more than one)")
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("only YAML or JSON documents with a map at the top can have their values sealed: %s", err)
+	}
+	for _, item := range doc {
+		if item.Key == sealedMetaKey {
+			return nil, fmt.Errorf("the values of this document have already been sealed")
+		}
+	}
+
+	backend = strings.Trim(backend, "/")
+	plainKey, wrappedKey, err := v.DataKey(ctx, backend, key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := walkValues(doc, "", func(path string, value interface{}) (interface{}, error) {
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		s, err := seal(plainKey, b, []byte(path))
+		if err != nil {
+			return nil, err
+		}
+		return sealedValuePrefix + base64.StdEncoding.EncodeToString(s) + sealedValueSuffix, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc = append(sealed.(yaml.MapSlice), yaml.MapItem{
+		Key: sealedMetaKey,
+		Value: sealedMeta{
+			Version: sealedVersion,
+			Cipher:  sealedCipher,
+			Backend: backend,
+			Key:     key,
+			DataKey: wrappedKey,
+		},
+	})
+	return yaml.Marshal(doc)
+}
+
+// UnsealValues decrypts the values of a YAML document sealed by
+// SealValues.
+func (v *Vault) UnsealValues(ctx context.Context, data []byte) ([]byte, error) {
+	if multiDocument(data) {
+		return nil, fmt.Errorf("not a sealed file, or a YAML document with sealed values (this file has more than one document)")
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("not a sealed file, or a YAML document with sealed values: %s", err)
+	}
+
+	var meta *sealedMeta
+	var rest yaml.MapSlice
+	for _, item := range doc {
+		if item.Key != sealedMetaKey {
+			rest = append(rest, item)
+			continue
+		}
+		b, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		meta = &sealedMeta{}
+		if err := yaml.Unmarshal(b, meta); err != nil {
+			return nil, fmt.Errorf("malformed %s metadata: %s", sealedMetaKey, err)
+		}
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("not a sealed file, or a YAML document with sealed values")
+	}
+	if meta.Version != sealedVersion || meta.Cipher != sealedCipher {
+		return nil, fmt.Errorf("unsupported sealed values format (version %s, cipher %s)", meta.Version, meta.Cipher)
+	}
+
+	plainKey, err := v.unwrapDataKey(ctx, meta.Backend, meta.Key, meta.DataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	unsealed, err := walkValues(rest, "", func(path string, value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok || !strings.HasPrefix(s, sealedValuePrefix) || !strings.HasSuffix(s, sealedValueSuffix) {
+			return nil, fmt.Errorf("%s is not sealed", path)
+		}
+		b, err := base64.StdEncoding.DecodeString(s[len(sealedValuePrefix) : len(s)-len(sealedValueSuffix)])
+		if err != nil {
+			return nil, fmt.Errorf("%s: corrupt sealed value: %s", path, err)
+		}
+		b, err = unseal(plainKey, b, []byte(path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		var v interface{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return v, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(unsealed)
+}
+
+// walkValues replaces each of the scalar values in a YAML document with
+// whatever f returns for it.  Values are identified by their path from
+// the top of the document, i.e. "db.password" or "hosts[1]".
+func walkValues(node interface{}, path string, f func(string, interface{}) (interface{}, error)) (interface{}, error) {
+	switch n := node.(type) {
+	case yaml.MapSlice:
+		out := make(yaml.MapSlice, len(n))
+		for i, item := range n {
+			sub := fmt.Sprintf("%v", item.Key)
+			if path != "" {
+				sub = path + "." + sub
+			}
+			v, err := walkValues(item.Value, sub, f)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = yaml.MapItem{Key: item.Key, Value: v}
+		}
+		return out, nil
+
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, item := range n {
+			v, err := walkValues(item, path+"["+strconv.Itoa(i)+"]", f)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	return f(path, node)
+}
+
+// multiDocument returns true if data holds more than one YAML document,
+// all but the first of which yaml.Unmarshal would silently ignore.
+// Document markers (--- and ...) only ever appear at the start of a
+// line, so there is no need to parse the documents to find them.
+func multiDocument(data []byte) bool {
+	content, ended := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t") {
+			if content || ended {
+				return true
+			}
+			line = strings.TrimSpace(line[3:])
+		}
+		if line == "..." {
+			ended = true
+			continue
+		}
+		if line == "" || strings.HasPrefix(strings.TrimSpace(line), "#") || strings.HasPrefix(line, "%") {
+			continue
+		}
+		if ended {
+			return true
+		}
+		content = true
+	}
+	return false
+}
+
+func (v *Vault) unwrapDataKey(ctx context.Context, backend, key, wrapped string) ([]byte, error) {
+	keys, err := v.Decrypt(ctx, backend, key, []string{wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap the data key with %s/%s: %s", backend, key, err)
+	}
+	if len(keys[0]) != 32 {
+		return nil, fmt.Errorf("unable to unwrap the data key with %s/%s: not a 256-bit key", backend, key)
+	}
+	return keys[0], nil
+}
+
+// seal encrypts plaintext with AES-GCM, and returns the nonce followed
+// by the ciphertext.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// unseal decrypts the output of seal.
+func unseal(key, sealed, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("corrupt sealed data")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt (the data was corrupted, or tampered with)")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
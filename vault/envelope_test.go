@@ -0,0 +1,282 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// transitVault returns a Vault backed by a fake transit backend, mounted
+// at transit/, whose "wrapping" of data keys is just a prefix, so that
+// any of its keys can unwrap them.
+func transitVault() (*Vault, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Batch []map[string]string `json:"batch_input"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+
+		var data interface{}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/transit/datakey/plaintext/"):
+			key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x42}, 32))
+			data = map[string]string{"plaintext": key, "ciphertext": "vault:v1:" + key}
+		case strings.HasPrefix(r.URL.Path, "/v1/transit/decrypt/"):
+			var results []map[string]string
+			for _, item := range in.Batch {
+				results = append(results, map[string]string{"plaintext": strings.TrimPrefix(item["ciphertext"], "vault:v1:")})
+			}
+			data = map[string]interface{}{"batch_results": results}
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"errors":["no handler for route"]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	return &Vault{URL: srv.URL, Client: srv.Client()}, srv.Close
+}
+
+func TestSealUnseal(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	other := bytes.Repeat([]byte{0x02}, 32)
+	plaintext := []byte("the password is hunter2")
+
+	sealed, err := seal(key, plaintext, []byte("db.password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Errorf("sealed data contains the plaintext")
+	}
+	again, err := seal(key, plaintext, []byte("db.password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Errorf("sealing the same plaintext twice gave the same result (nonce reuse)")
+	}
+
+	flipped := append([]byte{}, sealed...)
+	flipped[len(flipped)-1] ^= 0x01
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+		aad    string
+		ok     bool
+	}{
+		{"round trip", key, sealed, "db.password", true},
+		{"wrong key", other, sealed, "db.password", false},
+		{"wrong path", key, sealed, "db.username", false},
+		{"tampered ciphertext", key, flipped, "db.password", false},
+		{"truncated", key, sealed[:len(sealed)-1], "db.password", false},
+		{"shorter than a nonce", key, sealed[:4], "db.password", false},
+		{"not a 256-bit key", key[:7], sealed, "db.password", false},
+	}
+
+	for _, test := range tests {
+		got, err := unseal(test.key, test.sealed, []byte(test.aad))
+		if test.ok {
+			if err != nil {
+				t.Errorf("%s: unable to unseal: %s", test.name, err)
+			} else if !bytes.Equal(got, plaintext) {
+				t.Errorf("%s: unsealed %q, wanted %q", test.name, got, plaintext)
+			}
+		} else if err == nil {
+			t.Errorf("%s: unsealed %q, wanted an error", test.name, got)
+		}
+	}
+}
+
+func TestWalkValues(t *testing.T) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal([]byte("db:\n  user: admin\n  port: 5432\nhosts:\n- a\n- b: c\nempty: ~\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	out, err := walkValues(doc, "", func(path string, value interface{}) (interface{}, error) {
+		paths = append(paths, path)
+		return "<" + path + ">", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"db.user", "db.port", "hosts[0]", "hosts[1].b", "empty"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("walked %v, wanted %v", paths, want)
+	}
+
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "db:\n  user: <db.user>\n  port: <db.port>\nhosts:\n- <hosts[0]>\n- b: <hosts[1].b>\nempty: <empty>\n"
+	if string(b) != expect {
+		t.Errorf("walkValues gave\n%s\nwanted\n%s", b, expect)
+	}
+}
+
+func TestMultiDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"plain", "a: 1\nb: 2\n", false},
+		{"leading marker", "---\na: 1\n", false},
+		{"leading marker and comments", "# header\n%YAML 1.1\n--- # doc\na: 1\n", false},
+		{"trailing end marker", "a: 1\n...\n", false},
+		{"trailing end marker and comments", "a: 1\n...\n# bye\n\n", false},
+		{"json", "{\"a\": \"---\"}\n", false},
+		{"indented marker in a block scalar", "a: |\n  ---\n  x\n", false},
+		{"two documents", "a: 1\n---\nb: 2\n", true},
+		{"two documents with leading marker", "---\na: 1\n--- \nb: 2\n", true},
+		{"second document on the marker line", "a: 1\n--- {b: 2}\n", true},
+		{"content after end marker", "a: 1\n...\nb: 2\n", true},
+		{"empty", "", false},
+	}
+
+	for _, test := range tests {
+		if got := multiDocument([]byte(test.data)); got != test.want {
+			t.Errorf("%s: multiDocument(%q) = %v, wanted %v", test.name, test.data, got, test.want)
+		}
+	}
+}
+
+func TestSealFile(t *testing.T) {
+	v, done := transitVault()
+	defer done()
+	ctx := context.Background()
+
+	plaintext := []byte(strings.Repeat("some very secret data\n", 10))
+	sealed, err := v.SealFile(ctx, "/transit/", "k", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealedFile(sealed) {
+		t.Fatalf("sealed file does not look sealed:\n%s", sealed)
+	}
+	if !strings.HasPrefix(string(sealed), "$SAFE_SEALED;1;AES256_GCM;transit;k;vault:v1:") {
+		t.Errorf("unexpected header on sealed file:\n%s", sealed)
+	}
+
+	lines := strings.Split(string(sealed), "\n")
+	body := []byte(strings.Join(lines[1:], "\n"))
+	body[0] ^= 0x01
+	tampered := lines[0] + "\n" + string(body)
+
+	tests := []struct {
+		name   string
+		sealed string
+		err    string
+	}{
+		{"round trip", string(sealed), ""},
+		{"tampered header", strings.Replace(string(sealed), ";k;", ";j;", 1), "unable to decrypt"},
+		{"tampered data key", strings.Replace(string(sealed), ";k;", ";k;x", 1), "unable to unwrap"},
+		{"tampered body", tampered, "corrupt"},
+		{"newer version", strings.Replace(string(sealed), ";1;", ";2;", 1), "unsupported"},
+		{"not sealed", "hello\n", "not a sealed file"},
+		{"no body", lines[0], "corrupt"},
+	}
+
+	for _, test := range tests {
+		got, err := v.UnsealFile(ctx, []byte(test.sealed))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unable to unseal: %s", test.name, err)
+			} else if !bytes.Equal(got, plaintext) {
+				t.Errorf("%s: unsealed %q, wanted %q", test.name, got, plaintext)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %q (error %v), wanted an error containing %q", test.name, got, err, test.err)
+		}
+	}
+
+	if _, err := v.SealFile(ctx, "transit", "k;x", plaintext); err == nil {
+		t.Errorf("sealed a file with a ';' in its key name")
+	}
+}
+
+func TestSealValues(t *testing.T) {
+	v, done := transitVault()
+	defer done()
+	ctx := context.Background()
+
+	doc := "db:\n  user: admin\n  password: hunter2\n  port: 5432\nhosts:\n- a.example.com\n- b.example.com\n"
+	sealed, err := v.SealValues(ctx, "transit", "k", []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"admin", "hunter2", "5432", "example.com"} {
+		if strings.Contains(string(sealed), s) {
+			t.Errorf("sealed document still contains %q:\n%s", s, sealed)
+		}
+	}
+	for _, s := range []string{"db:", "password: SAFE[", "hosts:", "safe_sealed:"} {
+		if !strings.Contains(string(sealed), s) {
+			t.Errorf("sealed document is missing %q:\n%s", s, sealed)
+		}
+	}
+
+	/* swap the sealed user and password around */
+	var parsed yaml.MapSlice
+	if err := yaml.Unmarshal(sealed, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	db := parsed[0].Value.(yaml.MapSlice)
+	db[0].Value, db[1].Value = db[1].Value, db[0].Value
+	swapped, err := yaml.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sealed string
+		err    string
+	}{
+		{"round trip", string(sealed), ""},
+		{"values moved around", string(swapped), "db.user"},
+		{"value not sealed", strings.Replace(string(sealed), "hosts:\n", "hosts:\n- plain\n", 1), "hosts[0] is not sealed"},
+		{"no metadata", doc, "not a sealed file"},
+		{"another document", string(sealed) + "---\nx: 1\n", "more than one document"},
+	}
+
+	for _, test := range tests {
+		got, err := v.UnsealValues(ctx, []byte(test.sealed))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unable to unseal: %s", test.name, err)
+			} else if string(got) != doc {
+				t.Errorf("%s: unsealed\n%s\nwanted\n%s", test.name, got, doc)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %q (error %v), wanted an error containing %q", test.name, got, err, test.err)
+		}
+	}
+
+	if _, err := v.SealValues(ctx, "transit", "k", sealed); err == nil {
+		t.Errorf("sealed the values of a document twice")
+	}
+	if _, err := v.SealValues(ctx, "transit", "k", []byte("a: 1\n---\nb: 2\n")); err == nil {
+		t.Errorf("sealed the values of only the first of two documents")
+	}
+	if _, err := v.SealValues(ctx, "transit", "k", []byte("- a\n- b\n")); err == nil {
+		t.Errorf("sealed the values of a document without a map at the top")
+	}
+}
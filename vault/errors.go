@@ -1,7 +1,13 @@
 package vault
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
 )
 
 var NotFound error
@@ -9,3 +15,142 @@ var NotFound error
 func init() {
 	NotFound = fmt.Errorf("secret not found")
 }
+
+// An APIError is returned when the Vault responds to a request with
+// a status code other than the one(s) expected, and carries whatever
+// error messages the Vault sent back with it.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Errors     []string
+}
+
+// NewAPIError builds an APIError from a Vault response, consuming (and
+// closing) its body.
+func NewAPIError(res *http.Response) *APIError {
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	return DecodeErrorResponse(res, b)
+}
+
+// DecodeErrorResponse builds an APIError from a Vault response whose
+// body has already been read.
+func DecodeErrorResponse(res *http.Response, body []byte) *APIError {
+	e := &APIError{StatusCode: res.StatusCode}
+	if res.Request != nil {
+		e.Method = res.Request.Method
+		if res.Request.Method == "GET" && res.Request.URL.Query().Get("list") != "" {
+			e.Method = "LIST"
+		}
+		e.Path = strings.TrimPrefix(res.Request.URL.Path, "/v1/")
+	}
+
+	var r struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &r) == nil {
+		for _, msg := range r.Errors {
+			e.Errors = append(e.Errors, unwrapErrors(msg)...)
+		}
+	}
+	return e
+}
+
+// unwrapErrors splits up the "N errors occurred:\n\t* ..." messages
+// that newer Vaults send, so that each error is reported on its own.
+func unwrapErrors(msg string) []string {
+	msg = strings.TrimSpace(msg)
+	lines := strings.Split(msg, "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], "occurred:") {
+		return []string{msg}
+	}
+
+	var errs []string
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "* ") {
+			errs = append(errs, line[2:])
+		}
+	}
+	if len(errs) == 0 {
+		return []string{msg}
+	}
+	return errs
+}
+
+func (e *APIError) Error() string {
+	s := fmt.Sprintf("API %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Path != "" {
+		s = fmt.Sprintf("%s (%s %s)", s, e.Method, e.Path)
+	}
+	if len(e.Errors) > 0 {
+		s = fmt.Sprintf("%s: %s", s, strings.Join(e.Errors, "; "))
+	}
+	return s
+}
+
+func apiError(err error) (*APIError, bool) {
+	var e *APIError
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// IsPermissionDenied returns true if the error is the Vault refusing
+// a request because the token lacks the necessary policies (or is
+// not valid at all).
+func IsPermissionDenied(err error) bool {
+	e, ok := apiError(err)
+	return ok && e.StatusCode == 403
+}
+
+// IsSealed returns true if the error is the Vault refusing a request
+// because it is sealed (or otherwise unavailable).
+func IsSealed(err error) bool {
+	e, ok := apiError(err)
+	return ok && e.StatusCode == 503
+}
+
+// A ConflictError is returned by Update when the secret being updated
+// was modified by someone else between being read and written back.
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was modified by someone else while it was being updated; no changes were written", e.Path)
+}
+
+// IsConflict returns true if the error is a *ConflictError.
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// IsNotFound returns true if the error indicates that there was nothing
+// at the requested path.
+func IsNotFound(err error) bool {
+	if err == NotFound {
+		return true
+	}
+	e, ok := apiError(err)
+	return ok && e.StatusCode == 404
+}
+
+// An IncompleteError is returned when an operation on an entire tree of
+// secrets is interrupted (i.e. cancelled, or timed out) part of the way
+// through.  Done lists the paths that were processed successfully, and
+// Pending lists those that were not (or may not have been).
+type IncompleteError struct {
+	Err     error
+	Done    []string
+	Pending []string
+}
+
+func (e *IncompleteError) Error() string {
+	why := e.Err.Error()
+	if e.Err == context.Canceled {
+		why = "interrupted"
+	}
+	return fmt.Sprintf("%s after processing %d of %d paths", why, len(e.Done), len(e.Done)+len(e.Pending))
+}
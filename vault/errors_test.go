@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		denied   bool
+		notFound bool
+		sealed   bool
+	}{
+		{"403", &APIError{StatusCode: 403}, true, false, false},
+		{"404", &APIError{StatusCode: 404}, false, true, false},
+		{"503", &APIError{StatusCode: 503}, false, false, true},
+		{"500", &APIError{StatusCode: 500}, false, false, false},
+		{"NotFound", NotFound, false, true, false},
+		{"wrapped 403", fmt.Errorf("unable to do it: %w", &APIError{StatusCode: 403}), true, false, false},
+		{"flattened 403", fmt.Errorf("unable to do it: %s", &APIError{StatusCode: 403}), false, false, false},
+		{"conflict", &ConflictError{Path: "secret/x"}, false, false, false},
+		{"nil", nil, false, false, false},
+	}
+
+	for _, test := range tests {
+		if got := IsPermissionDenied(test.err); got != test.denied {
+			t.Errorf("%s: IsPermissionDenied() = %v, wanted %v", test.name, got, test.denied)
+		}
+		if got := IsNotFound(test.err); got != test.notFound {
+			t.Errorf("%s: IsNotFound() = %v, wanted %v", test.name, got, test.notFound)
+		}
+		if got := IsSealed(test.err); got != test.sealed {
+			t.Errorf("%s: IsSealed() = %v, wanted %v", test.name, got, test.sealed)
+		}
+	}
+}
+
+// TestTransitErrors checks that failures from the transit backend are
+// told apart the same way as those from anywhere else.
+func TestTransitErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		/* the key name is the status to respond with */
+		n, _ := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		w.WriteHeader(n)
+		w.Write([]byte(`{"errors":["1 error occurred:\n\t* it went wrong\n\n"]}`))
+	}))
+	defer srv.Close()
+	v := &Vault{URL: srv.URL, Client: srv.Client()}
+
+	tests := []struct {
+		status   int
+		denied   bool
+		notFound bool
+		sealed   bool
+	}{
+		{403, true, false, false},
+		{404, false, true, false},
+		{503, false, false, true},
+		{400, false, false, false},
+	}
+
+	for _, test := range tests {
+		_, err := v.Encrypt(context.Background(), "transit", strconv.Itoa(test.status), [][]byte{[]byte("x")}, 0)
+		if err == nil {
+			t.Errorf("%d: no error", test.status)
+			continue
+		}
+		if !strings.Contains(err.Error(), "it went wrong") {
+			t.Errorf("%d: error %q does not say what went wrong", test.status, err)
+		}
+		if IsPermissionDenied(err) != test.denied || IsNotFound(err) != test.notFound || IsSealed(err) != test.sealed {
+			t.Errorf("%d: %q is denied=%v, not found=%v, sealed=%v; wanted %v, %v, %v", test.status, err,
+				IsPermissionDenied(err), IsNotFound(err), IsSealed(err), test.denied, test.notFound, test.sealed)
+		}
+	}
+}
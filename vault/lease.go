@@ -0,0 +1,169 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Lease describes the lease that Vault attaches to dynamic credentials
+// (i.e. from the database or aws backends).  Once it runs out, Vault
+// revokes the credentials, unless the lease is renewed first.
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+}
+
+// LeaseInfo describes a lease, as returned by LookupLease.
+type LeaseInfo struct {
+	ID          string
+	IssueTime   time.Time
+	ExpireTime  time.Time
+	LastRenewal time.Time
+	Renewable   bool
+
+	// TTL is how long the lease has left to run, as of the lookup.
+	TTL time.Duration
+}
+
+// Creds reads dynamic credentials from path, and returns them along with
+// their lease.  Unlike Read, the path is used as-is, and if any params
+// are given, they are sent to Vault (i.e. a ttl, for aws/sts/...).
+// Every read hands out new credentials, so it is never retried, lest a
+// lost response leave credentials behind that nobody knows about.
+func (v *Vault) Creds(ctx context.Context, path string, params map[string]string) (*Secret, *Lease, error) {
+	method, body := "GET", ""
+	if len(params) > 0 {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		method, body = "POST", string(b)
+	}
+
+	req, err := http.NewRequest(method, v.url("/v1/%s", strings.Trim(path, "/")), strings.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := v.request(once(ctx), req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 404:
+		return nil, nil, NotFound
+	default:
+		return nil, nil, NewAPIError(res)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var r struct {
+		LeaseID       string                 `json:"lease_id"`
+		LeaseDuration int64                  `json:"lease_duration"`
+		Renewable     bool                   `json:"renewable"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	if err = decodeJSON(b, &r); err != nil {
+		return nil, nil, fmt.Errorf("malformed response from vault: %s", err)
+	}
+	if r.Data == nil {
+		return nil, nil, fmt.Errorf("malformed response from vault")
+	}
+
+	secret := NewSecret()
+	for k, v := range r.Data {
+		secret.data[k] = v
+	}
+	return secret, &Lease{
+		ID:        r.LeaseID,
+		Duration:  time.Duration(r.LeaseDuration) * time.Second,
+		Renewable: r.Renewable,
+	}, nil
+}
+
+// RenewLease renews the lease with the given ID, and returns it as it is
+// afterwards.  The increment asks for the lease to run that much longer
+// (Vault may grant less); zero leaves it up to Vault.
+func (v *Vault) RenewLease(ctx context.Context, id string, increment time.Duration) (*Lease, error) {
+	in := struct {
+		LeaseID   string `json:"lease_id"`
+		Increment int64  `json:"increment,omitempty"`
+	}{id, int64(increment / time.Second)}
+
+	var r struct {
+		LeaseID       string `json:"lease_id"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	}
+	if err := v.sys(ctx, "PUT", "leases/renew", in, &r); err != nil {
+		return nil, err
+	}
+	return &Lease{
+		ID:        r.LeaseID,
+		Duration:  time.Duration(r.LeaseDuration) * time.Second,
+		Renewable: r.Renewable,
+	}, nil
+}
+
+// RevokeLease revokes the lease with the given ID, and with it, the
+// credentials that it was handed out with.
+func (v *Vault) RevokeLease(ctx context.Context, id string) error {
+	in := struct {
+		LeaseID string `json:"lease_id"`
+	}{id}
+	return v.sys(ctx, "PUT", "leases/revoke", in, nil)
+}
+
+// RevokeLeasePrefix revokes every lease whose ID starts with prefix (i.e.
+// all of the credentials handed out for database/creds/readonly).
+func (v *Vault) RevokeLeasePrefix(ctx context.Context, prefix string) error {
+	return v.sys(ctx, "PUT", "leases/revoke-prefix/"+strings.Trim(prefix, "/"), nil, nil)
+}
+
+// LookupLease looks up the lease with the given ID.
+func (v *Vault) LookupLease(ctx context.Context, id string) (*LeaseInfo, error) {
+	in := struct {
+		LeaseID string `json:"lease_id"`
+	}{id}
+
+	var r struct {
+		Data *struct {
+			ID          string `json:"id"`
+			IssueTime   string `json:"issue_time"`
+			ExpireTime  string `json:"expire_time"`
+			LastRenewal string `json:"last_renewal"`
+			Renewable   bool   `json:"renewable"`
+			TTL         int64  `json:"ttl"`
+		} `json:"data"`
+	}
+	if err := v.sys(ctx, "PUT", "leases/lookup", in, &r); err != nil {
+		return nil, err
+	}
+	if r.Data == nil {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+
+	info := &LeaseInfo{
+		ID:        r.Data.ID,
+		Renewable: r.Data.Renewable,
+		TTL:       time.Duration(r.Data.TTL) * time.Second,
+	}
+	/* last_renewal (and expire_time, for leases that never
+	   expire) are null, which leaves them as the zero time */
+	info.IssueTime, _ = time.Parse(time.RFC3339Nano, r.Data.IssueTime)
+	info.ExpireTime, _ = time.Parse(time.RFC3339Nano, r.Data.ExpireTime)
+	info.LastRenewal, _ = time.Parse(time.RFC3339Nano, r.Data.LastRenewal)
+	return info, nil
+}
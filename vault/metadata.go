@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metadata is the part of a KV v2 metadata response that safe uses.
+type metadata struct {
+	Versions map[string]struct {
+		Created   string `json:"created_time"`
+		Deleted   string `json:"deletion_time"`
+		Destroyed bool   `json:"destroyed"`
+	} `json:"versions"`
+	Custom map[string]string `json:"custom_metadata"`
+}
+
+// metadata reads the metadata of the secret at the given path, which
+// must be on a KV v2 mount.
+func (v *Vault) metadata(ctx context.Context, path string) (*metadata, error) {
+	if _, _, ok := v.kv2(ctx, path); !ok {
+		return nil, fmt.Errorf("%s is not on a versioned (KV v2) mount", path)
+	}
+
+	req, err := http.NewRequest("GET", v.url("/v1/%s", v.kvPath(ctx, path, "metadata")), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 404:
+		return nil, NotFound
+	default:
+		return nil, NewAPIError(res)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Data metadata `json:"data"`
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r.Data, nil
+}
+
+// Metadata returns the custom metadata (i.e. an owner, or a ticket
+// number) recorded alongside the secret at the given path, which must
+// be on a KV v2 mount.
+func (v *Vault) Metadata(ctx context.Context, path string) (map[string]string, error) {
+	m, err := v.metadata(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if m.Custom == nil {
+		return map[string]string{}, nil
+	}
+	return m.Custom, nil
+}
+
+// SetMetadata replaces the custom metadata of the secret at the given
+// path, which must be on a KV v2 mount, with the given keys and values.
+func (v *Vault) SetMetadata(ctx context.Context, path string, custom map[string]string) error {
+	if _, _, ok := v.kv2(ctx, path); !ok {
+		return fmt.Errorf("%s is not on a versioned (KV v2) mount", path)
+	}
+	if custom == nil {
+		custom = map[string]string{}
+	}
+
+	b, err := json.Marshal(struct {
+		Custom map[string]string `json:"custom_metadata"`
+	}{custom})
+	if err != nil {
+		return err
+	}
+
+	/* this replaces the metadata wholesale, so it's safe to retry */
+	req, err := http.NewRequest("PUT", v.url("/v1/%s", v.kvPath(ctx, path, "metadata")), strings.NewReader(string(b)))
+	if err != nil {
+		return err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 204:
+		break
+	default:
+		return NewAPIError(res)
+	}
+
+	return nil
+}
+
+// MetadataAll reads the custom metadata of the secrets at each of the
+// given paths, in parallel.  Paths that are not on a KV v2 mount, or
+// that have no custom metadata, are left out.
+func (v *Vault) MetadataAll(ctx context.Context, paths []string) (map[string]map[string]string, error) {
+	var lock sync.Mutex
+	all := make(map[string]map[string]string)
+
+	err := v.each(ctx, paths, func(ctx context.Context, path string) error {
+		if _, _, ok := v.kv2(ctx, path); !ok {
+			return nil
+		}
+		m, err := v.Metadata(ctx, path)
+		if err == NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(m) > 0 {
+			lock.Lock()
+			all[path] = m
+			lock.Unlock()
+		}
+		return nil
+	})
+	return all, err
+}
+
+// FormatMetadata renders custom metadata on a single line, as sorted,
+// comma-separated key=value pairs.
+func FormatMetadata(m map[string]string) string {
+	var l []string
+	for k, v := range m {
+		l = append(l, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(l)
+	return strings.Join(l, ", ")
+}
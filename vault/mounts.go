@@ -0,0 +1,274 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type mount struct {
+	Type        string            `json:"type"`
+	Description string            `json:"description"`
+	Options     map[string]string `json:"options"`
+	Config      struct {
+		DefaultLeaseTTL int64 `json:"default_lease_ttl"`
+		MaxLeaseTTL     int64 `json:"max_lease_ttl"`
+	} `json:"config"`
+}
+
+// version returns the KV version of the mount, or 0 if the mount is not a
+// key/value (or generic) secret backend.
+func (m mount) version() int {
+	switch m.Type {
+	case "kv":
+		if m.Options["version"] == "2" {
+			return 2
+		}
+		return 1
+	case "generic":
+		return 1
+	}
+	return 0
+}
+
+// parseMounts extracts the mount table from either a sys/mounts response
+// (which older Vaults return without a "data" wrapper) or from the
+// sys/internal/ui/mounts response.
+func parseMounts(b []byte) (map[string]mount, bool) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, false
+	}
+
+	if data, ok := raw["data"]; ok {
+		var inner map[string]json.RawMessage
+		if err := json.Unmarshal(data, &inner); err == nil && len(inner) > 0 {
+			raw = inner
+			if secret, ok := raw["secret"]; ok {
+				if err := json.Unmarshal(secret, &inner); err == nil {
+					raw = inner
+				}
+			}
+		}
+	}
+
+	mounts := make(map[string]mount)
+	for path, b := range raw {
+		var m mount
+		if err := json.Unmarshal(b, &m); err != nil || m.Type == "" {
+			continue
+		}
+		mounts[strings.Trim(path, "/")+"/"] = m
+	}
+	return mounts, true
+}
+
+// loadMounts looks up the type and version of every secret backend the
+// current token can see.  This happens at most once per Vault object; if
+// neither of the mount listing endpoints is available (pre-0.10 Vaults,
+// or tokens lacking access to sys/mounts), every path is treated as a KV
+// version 1 path, as it always has been.
+func (v *Vault) loadMounts(ctx context.Context) map[string]mount {
+	v.mountsLock.Lock()
+	defer v.mountsLock.Unlock()
+
+	if v.mounts != nil {
+		return v.mounts
+	}
+
+	v.mounts = make(map[string]mount)
+	for _, path := range []string{"sys/internal/ui/mounts", "sys/mounts"} {
+		req, err := http.NewRequest("GET", v.url("/v1/%s", path), nil)
+		if err != nil {
+			continue
+		}
+		res, err := v.request(ctx, req)
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || res.StatusCode != 200 {
+			continue
+		}
+		if mounts, ok := parseMounts(b); ok {
+			v.mounts = mounts
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		/* don't cache what we couldn't find out */
+		mounts := v.mounts
+		v.mounts = nil
+		return mounts
+	}
+	return v.mounts
+}
+
+// mountFor returns the mount point (with a trailing slash) that the given
+// path lives under, along with its details, using the longest match.
+func (v *Vault) mountFor(ctx context.Context, path string) (string, mount, bool) {
+	mounts := v.loadMounts(ctx)
+	var prefixes []string
+	for prefix := range mounts {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(prefixes)))
+
+	path = strings.Trim(path, "/") + "/"
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return prefix, mounts[prefix], true
+		}
+	}
+	return "", mount{}, false
+}
+
+// kv2 splits a path on a KV version 2 mount into the mount point (with a
+// trailing slash) and the path of the secret relative to that mount.  The
+// final return value is false for paths that do not live on a KV v2 mount.
+func (v *Vault) kv2(ctx context.Context, path string) (string, string, bool) {
+	prefix, m, ok := v.mountFor(ctx, path)
+	if !ok || m.version() != 2 {
+		return "", "", false
+	}
+	rel := strings.TrimPrefix(strings.Trim(path, "/")+"/", prefix)
+	return prefix, strings.TrimSuffix(rel, "/"), true
+}
+
+// kvPath translates a logical secret path into the API path that should
+// be used to access it.  For KV v2 mounts, the endpoint (one of "data",
+// "metadata", "delete", "undelete" or "destroy") is inserted after the
+// mount point; everything else is returned as-is.
+func (v *Vault) kvPath(ctx context.Context, path, endpoint string) string {
+	if prefix, rel, ok := v.kv2(ctx, path); ok {
+		return prefix + endpoint + "/" + rel
+	}
+	return path
+}
+
+// forgetMounts discards the cached mount table, after mounts have been
+// changed, so that it is looked up again the next time it's needed.
+func (v *Vault) forgetMounts() {
+	v.mountsLock.Lock()
+	defer v.mountsLock.Unlock()
+	v.mounts = nil
+}
+
+// A Mount describes a secrets engine mounted in the Vault.
+type Mount struct {
+	Path        string
+	Type        string
+	Description string
+
+	// Version is the KV version of key/value mounts, and 0 for all
+	// other types of secrets engine.
+	Version int
+
+	Options         map[string]string
+	DefaultLeaseTTL time.Duration
+	MaxLeaseTTL     time.Duration
+}
+
+// MountConfig holds the settings for mounting a secrets engine, or for
+// tuning one that is already mounted.  Empty settings are left as they
+// are (or set to Vault's defaults, for new mounts).  TTLs are given as
+// Vault durations, i.e. "768h".
+type MountConfig struct {
+	Description     string
+	DefaultLeaseTTL string
+	MaxLeaseTTL     string
+	Options         map[string]string
+}
+
+// Mounts lists all of the secrets engines mounted in the Vault, sorted
+// by path.
+func (v *Vault) Mounts(ctx context.Context) ([]Mount, error) {
+	req, err := http.NewRequest("GET", v.url("/v1/sys/mounts"), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, NewAPIError(res)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	mounts, ok := parseMounts(b)
+	if !ok {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+
+	var l []Mount
+	for path, m := range mounts {
+		l = append(l, Mount{
+			Path:            path,
+			Type:            m.Type,
+			Description:     m.Description,
+			Version:         m.version(),
+			Options:         m.Options,
+			DefaultLeaseTTL: time.Duration(m.Config.DefaultLeaseTTL) * time.Second,
+			MaxLeaseTTL:     time.Duration(m.Config.MaxLeaseTTL) * time.Second,
+		})
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Path < l[j].Path })
+	return l, nil
+}
+
+// Mount mounts a new secrets engine of the given type (i.e. "kv", or
+// "pki") at path.
+func (v *Vault) Mount(ctx context.Context, typ, path string, c MountConfig) error {
+	defer v.forgetMounts()
+	return v.sys(ctx, "POST", "mounts/"+strings.Trim(path, "/"), struct {
+		Type        string            `json:"type"`
+		Description string            `json:"description,omitempty"`
+		Config      mountTune         `json:"config"`
+		Options     map[string]string `json:"options,omitempty"`
+	}{typ, c.Description, mountTune{DefaultLeaseTTL: c.DefaultLeaseTTL, MaxLeaseTTL: c.MaxLeaseTTL}, c.Options}, nil)
+}
+
+// Unmount unmounts the secrets engine at path, permanently deleting all
+// of the secrets stored in it.
+func (v *Vault) Unmount(ctx context.Context, path string) error {
+	defer v.forgetMounts()
+	return v.sys(ctx, "DELETE", "mounts/"+strings.Trim(path, "/"), nil, nil)
+}
+
+// Tune changes the settings of the secrets engine mounted at path.
+func (v *Vault) Tune(ctx context.Context, path string, c MountConfig) error {
+	defer v.forgetMounts()
+	return v.sys(ctx, "POST", "mounts/"+strings.Trim(path, "/")+"/tune", mountTune{
+		Description:     c.Description,
+		DefaultLeaseTTL: c.DefaultLeaseTTL,
+		MaxLeaseTTL:     c.MaxLeaseTTL,
+		Options:         c.Options,
+	}, nil)
+}
+
+type mountTune struct {
+	Description     string            `json:"description,omitempty"`
+	DefaultLeaseTTL string            `json:"default_lease_ttl,omitempty"`
+	MaxLeaseTTL     string            `json:"max_lease_ttl,omitempty"`
+	Options         map[string]string `json:"options,omitempty"`
+}
+
+// Remount moves the secrets engine mounted at one path (and all of its
+// secrets) to another.
+func (v *Vault) Remount(ctx context.Context, from, to string) error {
+	defer v.forgetMounts()
+	return v.sys(ctx, "POST", "remount", struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{strings.Trim(from, "/"), strings.Trim(to, "/")}, nil)
+}
@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseMounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     map[string]int
+	}{
+		{
+			name: "sys/mounts without a data wrapper",
+			response: `{
+				"secret/": {"type": "kv", "options": {"version": "2"}},
+				"old/": {"type": "generic"},
+				"sys/": {"type": "system"},
+				"request_id": "abc"
+			}`,
+			want: map[string]int{"secret/": 2, "old/": 1, "sys/": 0},
+		},
+		{
+			name: "sys/mounts with a data wrapper",
+			response: `{
+				"data": {
+					"secret/": {"type": "kv", "options": {"version": "1"}},
+					"kv": {"type": "kv", "options": {"version": "2"}}
+				}
+			}`,
+			want: map[string]int{"secret/": 1, "kv/": 2},
+		},
+		{
+			name: "sys/internal/ui/mounts",
+			response: `{
+				"data": {
+					"auth": {"token/": {"type": "token"}},
+					"secret": {
+						"secret/": {"type": "kv", "options": null},
+						"team/a/": {"type": "kv", "options": {"version": "2"}}
+					}
+				}
+			}`,
+			want: map[string]int{"secret/": 1, "team/a/": 2},
+		},
+	}
+
+	for _, test := range tests {
+		mounts, ok := parseMounts([]byte(test.response))
+		if !ok {
+			t.Errorf("%s: unable to parse mounts", test.name)
+			continue
+		}
+		if len(mounts) != len(test.want) {
+			t.Errorf("%s: got %d mounts (%v), wanted %d", test.name, len(mounts), mounts, len(test.want))
+		}
+		for path, version := range test.want {
+			m, ok := mounts[path]
+			if !ok {
+				t.Errorf("%s: %s is missing", test.name, path)
+				continue
+			}
+			if m.version() != version {
+				t.Errorf("%s: %s is KV version %d, wanted %d", test.name, path, m.version(), version)
+			}
+		}
+	}
+
+	if _, ok := parseMounts([]byte(`not json`)); ok {
+		t.Errorf("parsed a mount table out of something that isn't JSON")
+	}
+}
+
+func TestKVPath(t *testing.T) {
+	v := &Vault{mounts: map[string]mount{
+		"secret/":  {Type: "kv", Options: map[string]string{"version": "1"}},
+		"kv/":      {Type: "kv", Options: map[string]string{"version": "2"}},
+		"kv/sub/":  {Type: "kv"},
+		"team/a/":  {Type: "kv", Options: map[string]string{"version": "2"}},
+		"pki/":     {Type: "pki"},
+		"generic/": {Type: "generic"},
+	}}
+
+	tests := []struct {
+		path     string
+		endpoint string
+		want     string
+	}{
+		{"secret/x/y", "data", "secret/x/y"},
+		{"generic/x", "metadata", "generic/x"},
+		{"pki/issue/web", "data", "pki/issue/web"},
+		{"nowhere/x", "data", "nowhere/x"},
+		{"kv/x/y", "data", "kv/data/x/y"},
+		{"kv/x/y", "metadata", "kv/metadata/x/y"},
+		{"kv/x", "destroy", "kv/destroy/x"},
+		{"/kv/x/", "data", "kv/data/x"},
+		{"kv", "metadata", "kv/metadata/"},
+		{"kv/sub/x", "data", "kv/sub/x"},
+		{"team/a/x", "data", "team/a/data/x"},
+		{"team/ab/x", "data", "team/ab/x"},
+	}
+
+	for _, test := range tests {
+		got := v.kvPath(context.Background(), test.path, test.endpoint)
+		if got != test.want {
+			t.Errorf("kvPath(%q, %q) = %q, wanted %q", test.path, test.endpoint, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"context"
+	"sort"
+)
+
+// Policies lists the names of all of the ACL policies in the Vault.
+func (v *Vault) Policies(ctx context.Context) ([]string, error) {
+	var r struct {
+		Policies []string `json:"policies"`
+	}
+	if err := v.sys(ctx, "GET", "policy", nil, &r); err != nil {
+		return nil, err
+	}
+	sort.Strings(r.Policies)
+	return r.Policies, nil
+}
+
+// Policy returns the rules (in HCL) of the named ACL policy, or the
+// NotFound error if there is no such policy.
+func (v *Vault) Policy(ctx context.Context, name string) (string, error) {
+	var r struct {
+		Rules string `json:"rules"`
+	}
+	if err := v.sys(ctx, "GET", "policy/"+name, nil, &r); err != nil {
+		if IsNotFound(err) {
+			return "", NotFound
+		}
+		return "", err
+	}
+	return r.Rules, nil
+}
+
+// SetPolicy creates the named ACL policy, or replaces its rules if it
+// already exists.
+func (v *Vault) SetPolicy(ctx context.Context, name, rules string) error {
+	return v.sys(ctx, "PUT", "policy/"+name, struct {
+		Policy string `json:"policy"`
+	}{rules}, nil)
+}
+
+// DeletePolicy deletes the named ACL policy.  Tokens that had it are
+// left with their other policies.
+func (v *Vault) DeletePolicy(ctx context.Context, name string) error {
+	return v.sys(ctx, "DELETE", "policy/"+name, nil, nil)
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// MaxRedirects is the number of HA redirects that will be followed for
+// a single request, before giving up.
+const MaxRedirects = 10
+
+// noRedirects keeps net/http from following redirects on its own, so
+// that they can be handled by FollowRedirect instead.
+func noRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// trustRedirects returns true if $SAFE_TRUST_REDIRECTS says it is okay
+// to follow redirects to other hosts.
+func trustRedirects() bool {
+	t := os.Getenv("SAFE_TRUST_REDIRECTS")
+	return t != "" && t != "0" && t != "false" && t != "no" && t != "off"
+}
+
+// IsRedirect returns true if the response is a redirect that should be
+// followed.  Vault uses 307s to send clients from standby nodes to the
+// active node of an HA cluster.
+func IsRedirect(res *http.Response) bool {
+	return res.StatusCode == 307 || res.StatusCode == 308
+}
+
+// FollowRedirect points req at the Location given in a redirect
+// response, so that it can be sent again with the same method, headers
+// and body.  Relative locations are resolved against the URL of the
+// redirected request, and the original query string is carried over
+// if the new location does not have one of its own.
+//
+// Since requests carry either a Vault token or login credentials,
+// FollowRedirect refuses to switch to a different scheme or host than
+// that of the origin URL (where the request was first sent), unless
+// $SAFE_TRUST_REDIRECTS is set.
+func FollowRedirect(req *http.Request, res *http.Response, origin *url.URL) error {
+	location := res.Header.Get("Location")
+	if location == "" {
+		return fmt.Errorf("%s redirect from %s has no Location", res.Status, req.URL)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid redirect from %s: %s", req.URL, err)
+	}
+	u = req.URL.ResolveReference(u)
+	if u.RawQuery == "" {
+		u.RawQuery = req.URL.RawQuery
+	}
+
+	if (u.Scheme != origin.Scheme || u.Host != origin.Host) && !trustRedirects() {
+		return fmt.Errorf("refusing to follow redirect from %s://%s to %s://%s; set trust_redirects for this target in ~/.saferc (or $SAFE_TRUST_REDIRECTS) to allow it",
+			origin.Scheme, origin.Host, u.Scheme, u.Host)
+	}
+
+	req.URL = u
+	req.Host = ""
+	return nil
+}
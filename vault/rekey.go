@@ -0,0 +1,123 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// RekeyStatus describes the progress of rekeying a Vault, i.e. splitting
+// its master key into a new set of unseal keys.  Once enough of the
+// current unseal keys have been provided, the rekey is Complete, and Keys
+// holds the new unseal keys (encrypted, if PGP keys were given).
+type RekeyStatus struct {
+	Nonce           string   `json:"nonce"`
+	Started         bool     `json:"started"`
+	Shares          int      `json:"n"`
+	Threshold       int      `json:"t"`
+	Progress        int      `json:"progress"`
+	Required        int      `json:"required"`
+	PGPFingerprints []string `json:"pgp_fingerprints"`
+	Backup          bool     `json:"backup"`
+
+	Complete bool     `json:"complete"`
+	Keys     []string `json:"keys"`
+}
+
+// RekeyStatus returns the status of the rekey in progress, if there is
+// one.  This does not need a token.
+func (v *Vault) RekeyStatus(ctx context.Context) (*RekeyStatus, error) {
+	var s RekeyStatus
+	if err := v.sys(ctx, "GET", "rekey/init", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// StartRekey starts rekeying the Vault into the given number of unseal
+// key shares, threshold of which will be needed to unseal it.  If any
+// PGP keys are given (see ReadPGPKey), there must be one per share, and
+// each new unseal key is encrypted with the corresponding PGP key; with
+// backup, Vault also keeps a copy of the encrypted keys.  This is never
+// retried, since it would fail for the rekey that it had already started.
+func (v *Vault) StartRekey(ctx context.Context, shares, threshold int, pgpKeys []string, backup bool) (*RekeyStatus, error) {
+	var s RekeyStatus
+	in := struct {
+		Shares    int      `json:"secret_shares"`
+		Threshold int      `json:"secret_threshold"`
+		PGPKeys   []string `json:"pgp_keys,omitempty"`
+		Backup    bool     `json:"backup,omitempty"`
+	}{shares, threshold, pgpKeys, backup}
+	if err := v.sys(once(ctx), "PUT", "rekey/init", in, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// RekeyUpdate provides one of the current unseal keys to the rekey with
+// the given nonce.  This does not need a token, and is never retried,
+// since a lost response to the last key would lose the new unseal keys
+// (the old ones no longer work by then).
+func (v *Vault) RekeyUpdate(ctx context.Context, key, nonce string) (*RekeyStatus, error) {
+	var s RekeyStatus
+	in := struct {
+		Key   string `json:"key"`
+		Nonce string `json:"nonce"`
+	}{key, nonce}
+	if err := v.sys(once(ctx), "PUT", "rekey/update", in, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CancelRekey cancels the rekey in progress, throwing away any unseal
+// keys provided so far.  This does not need a token.
+func (v *Vault) CancelRekey(ctx context.Context) error {
+	return v.sys(ctx, "DELETE", "rekey/init", nil, nil)
+}
+
+// ReadPGPKey reads a PGP public key from a file (either binary, or ASCII
+// armored), and returns it base64-encoded, as Vault expects it.  Keys of
+// the form keybase:username are returned as-is, for Vault to fetch.
+func ReadPGPKey(file string) (string, error) {
+	if strings.HasPrefix(file, "keybase:") {
+		return file, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN PGP")) {
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+
+	/* the body of an ASCII armored key is already base64; we just
+	   need to skip the armor headers, and drop the checksum */
+	var body []string
+	inBody := false
+	scan := bufio.NewScanner(bytes.NewReader(b))
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		switch {
+		case strings.HasPrefix(line, "-----END PGP"):
+			if len(body) == 0 {
+				return "", fmt.Errorf("%s does not contain a PGP public key", file)
+			}
+			return strings.Join(body, ""), nil
+		case strings.HasPrefix(line, "-----BEGIN PGP"):
+			inBody = false
+		case !inBody:
+			inBody = line == ""
+		case strings.HasPrefix(line, "="):
+			/* checksum */
+		default:
+			body = append(body, line)
+		}
+	}
+	return "", fmt.Errorf("%s does not contain a PGP public key", file)
+}
@@ -0,0 +1,146 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// A RetryPolicy governs how requests that fail for transient reasons
+// (dropped connections, 5xx and 429 responses, sealed or standby nodes)
+// are retried.  Only idempotent requests are ever retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a request will be tried.
+	MaxAttempts int
+
+	// Wait is how long to wait before the first retry; each subsequent
+	// retry waits twice as long as the last, up to MaxWait.
+	Wait    time.Duration
+	MaxWait time.Duration
+}
+
+// DefaultRetryPolicy retries idempotent requests twice, starting with
+// a half-second wait.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Wait:        500 * time.Millisecond,
+	MaxWait:     30 * time.Second,
+}
+
+// retryPolicy builds a RetryPolicy from the environment, using
+// $VAULT_MAX_RETRIES, $SAFE_RETRY_WAIT and $SAFE_RETRY_MAX_WAIT.
+func retryPolicy() RetryPolicy {
+	p := DefaultRetryPolicy
+	if n, err := strconv.Atoi(os.Getenv("VAULT_MAX_RETRIES")); err == nil && n >= 0 {
+		p.MaxAttempts = n + 1
+	}
+	if d, err := time.ParseDuration(os.Getenv("SAFE_RETRY_WAIT")); err == nil && d > 0 {
+		p.Wait = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SAFE_RETRY_MAX_WAIT")); err == nil && d > 0 {
+		p.MaxWait = d
+	}
+	if p.MaxWait < p.Wait {
+		p.MaxWait = p.Wait
+	}
+	return p
+}
+
+type noRetryKey struct{}
+
+// once returns a context for requests that must never be retried, even
+// though their method says that they can be, because the first attempt
+// may have taken effect even if its response was lost (i.e. initializing
+// a Vault, which hands out the only copy of its unseal keys).
+func once(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func idempotent(req *http.Request) bool {
+	if req.Context().Value(noRetryKey{}) != nil {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE", "LIST":
+		return true
+	}
+	return false
+}
+
+// transient returns true if the given transport error is likely to go
+// away on its own; TLS verification failures, for example, will not.
+func transient(err error) bool {
+	var (
+		verify    *tls.CertificateVerificationError
+		authority x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		header    tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &verify), errors.As(err, &authority), errors.As(err, &hostname),
+		errors.As(err, &invalid), errors.As(err, &header):
+		return false
+	}
+	return true
+}
+
+// retryable determines whether or not the outcome of a request warrants
+// trying it again.
+func (p RetryPolicy) retryable(req *http.Request, res *http.Response, err error) bool {
+	if !idempotent(req) {
+		return false
+	}
+	if err != nil {
+		return transient(err)
+	}
+	switch res.StatusCode {
+	case 429, 500, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// backoff returns how long to wait before retrying, after the given
+// (1-based) number of attempts.  The wait grows exponentially, with
+// jitter, but a Retry-After header from the Vault takes precedence.
+func (p RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if after := res.Header.Get("Retry-After"); after != "" {
+			if n, err := strconv.Atoi(after); err == nil && n >= 0 {
+				return p.cap(time.Duration(n) * time.Second)
+			}
+			if t, err := http.ParseTime(after); err == nil {
+				return p.cap(t.Sub(time.Now()))
+			}
+		}
+	}
+
+	d := p.Wait
+	for i := 1; i < attempt && d < p.MaxWait; i++ {
+		d *= 2
+	}
+	d = p.cap(d)
+	if d <= 0 {
+		return 0
+	}
+	/* jitter the wait across the upper half of the window, so
+	   that concurrent requests don't all retry in lock-step */
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p RetryPolicy) cap(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	if d > p.MaxWait {
+		return p.MaxWait
+	}
+	return d
+}
@@ -0,0 +1,202 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, Wait: time.Second, MaxWait: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{9, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		/* the jitter is random, so try it a few times */
+		for i := 0; i < 50; i++ {
+			d := p.backoff(test.attempt, nil)
+			if d < test.max/2 || d > test.max {
+				t.Errorf("backoff after attempt %d was %s, wanted %s-%s", test.attempt, d, test.max/2, test.max)
+				break
+			}
+		}
+	}
+
+	if d := (RetryPolicy{}).backoff(1, nil); d != 0 {
+		t.Errorf("backoff with no wait was %s, wanted 0", d)
+	}
+}
+
+func TestBackoffRetryAfter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, Wait: time.Second, MaxWait: 30 * time.Second}
+
+	tests := []struct {
+		name  string
+		after string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"seconds", "5", 5 * time.Second, 5 * time.Second},
+		{"no wait", "0", 0, 0},
+		{"seconds beyond MaxWait", "120", 30 * time.Second, 30 * time.Second},
+		{"HTTP date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"HTTP date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+		{"HTTP date beyond MaxWait", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 30 * time.Second, 30 * time.Second},
+		{"garbage", "soon", 500 * time.Millisecond, time.Second},
+		{"negative", "-5", 500 * time.Millisecond, time.Second},
+	}
+
+	for _, test := range tests {
+		res := &http.Response{StatusCode: 429, Header: http.Header{}}
+		res.Header.Set("Retry-After", test.after)
+		d := p.backoff(1, res)
+		if d < test.min || d > test.max {
+			t.Errorf("%s: backoff with Retry-After: %s was %s, wanted %s-%s", test.name, test.after, d, test.min, test.max)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	p := DefaultRetryPolicy
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		method string
+		ctx    context.Context
+		status int
+		err    error
+		want   bool
+	}{
+		{"GET 503", "GET", ctx, 503, nil, true},
+		{"PUT 429", "PUT", ctx, 429, nil, true},
+		{"DELETE 500", "DELETE", ctx, 500, nil, true},
+		{"LIST 502", "LIST", ctx, 502, nil, true},
+		{"GET 504", "GET", ctx, 504, nil, true},
+		{"GET 200", "GET", ctx, 200, nil, false},
+		{"GET 404", "GET", ctx, 404, nil, false},
+		{"GET 403", "GET", ctx, 403, nil, false},
+		{"POST 503", "POST", ctx, 503, nil, false},
+		{"once PUT 503", "PUT", once(ctx), 503, nil, false},
+		{"once GET 503", "GET", once(ctx), 503, nil, false},
+		{"GET connection refused", "GET", ctx, 0, errors.New("connection refused"), true},
+		{"POST connection refused", "POST", ctx, 0, errors.New("connection refused"), false},
+		{"GET unknown CA", "GET", ctx, 0, &url.Error{Op: "Get", URL: "https://vault", Err: x509.UnknownAuthorityError{}}, false},
+		{"GET failed verification", "GET", ctx, 0, &url.Error{Op: "Get", URL: "https://vault", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{"GET wrong hostname", "GET", ctx, 0, &url.Error{Op: "Get", URL: "https://vault", Err: &tls.CertificateVerificationError{Err: x509.HostnameError{Host: "vault"}}}, false},
+		{"GET not TLS", "GET", ctx, 0, &url.Error{Op: "Get", URL: "https://vault", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}, false},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, "https://vault/v1/secret/x", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(test.ctx)
+		var res *http.Response
+		if test.err == nil {
+			res = &http.Response{StatusCode: test.status, Header: http.Header{}}
+		}
+		if got := p.retryable(req, res, test.err); got != test.want {
+			t.Errorf("%s: retryable() = %v, wanted %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRequestRetries(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		Retry:  RetryPolicy{MaxAttempts: 3, Wait: time.Millisecond, MaxWait: time.Millisecond},
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		hits   int
+		status int
+	}{
+		{"retried", context.Background(), 2, 200},
+		{"never retried", once(context.Background()), 1, 503},
+	}
+
+	for _, test := range tests {
+		hits = 0
+		req, err := http.NewRequest("PUT", v.url("/v1/sys/init"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := v.request(test.ctx, req)
+		if err != nil {
+			t.Errorf("%s: request failed: %s", test.name, err)
+			continue
+		}
+		res.Body.Close()
+		if hits != test.hits || res.StatusCode != test.status {
+			t.Errorf("%s: got a %d after %d attempts, wanted a %d after %d", test.name, res.StatusCode, hits, test.status, test.hits)
+		}
+	}
+}
+
+func TestRequestUntrustedCertificate(t *testing.T) {
+	connections := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request made it past certificate verification")
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	/* a client that doesn't trust the test server's certificate */
+	v := &Vault{
+		URL:    srv.URL,
+		Client: &http.Client{Transport: &http.Transport{}},
+		Retry:  RetryPolicy{MaxAttempts: 3, Wait: time.Millisecond, MaxWait: time.Millisecond},
+	}
+	req, err := http.NewRequest("GET", v.url("/v1/sys/health"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.request(context.Background(), req); err == nil {
+		t.Fatalf("request to an untrusted Vault succeeded")
+	}
+	if connections != 1 {
+		t.Errorf("made %d attempts at an untrusted Vault, wanted 1", connections)
+	}
+}
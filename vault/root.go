@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// GenerateRootStatus describes the progress of generating a new root
+// token.  Once enough unseal keys have been provided, the generation is
+// Complete, and EncodedToken holds the new root token, either encrypted
+// with the PGP key it was started with, or encoded with the one-time
+// password (see DecodeRootToken).
+type GenerateRootStatus struct {
+	Nonce          string `json:"nonce"`
+	Started        bool   `json:"started"`
+	Progress       int    `json:"progress"`
+	Required       int    `json:"required"`
+	PGPFingerprint string `json:"pgp_fingerprint"`
+
+	/* newer Vaults generate the one-time password themselves (and
+	   tell us how long it will be); older ones expect us to */
+	OTP       string `json:"otp"`
+	OTPLength int    `json:"otp_length"`
+
+	Complete         bool   `json:"complete"`
+	EncodedToken     string `json:"encoded_token"`
+	EncodedRootToken string `json:"encoded_root_token"`
+}
+
+// Token returns the encoded (or encrypted) root token, once the root
+// token generation is complete.
+func (s *GenerateRootStatus) Token() string {
+	if s.EncodedToken != "" {
+		return s.EncodedToken
+	}
+	return s.EncodedRootToken
+}
+
+// Legacy returns true if the Vault is one of the older ones that expect
+// to be given a one-time password (see NewOTP), rather than generating
+// one itself, and that encode the new root token accordingly.
+func (s *GenerateRootStatus) Legacy() bool {
+	return s.OTPLength == 0
+}
+
+// GenerateRootStatus returns the status of the root token generation in
+// progress, if there is one.  This does not need a token.
+func (v *Vault) GenerateRootStatus(ctx context.Context) (*GenerateRootStatus, error) {
+	var s GenerateRootStatus
+	if err := v.sys(ctx, "GET", "generate-root/attempt", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// StartGenerateRoot starts generating a new root token, which will be
+// encrypted with the given PGP key (see ReadPGPKey), if there is one, or
+// encoded with a one-time password.  For older Vaults, that password has
+// to be given (see NewOTP); newer Vaults generate it themselves, and hand
+// it back in the OTP field of the returned status.  This is never
+// retried, since a lost response would lose that password.
+func (v *Vault) StartGenerateRoot(ctx context.Context, otp, pgpKey string) (*GenerateRootStatus, error) {
+	var s GenerateRootStatus
+	in := struct {
+		OTP    string `json:"otp,omitempty"`
+		PGPKey string `json:"pgp_key,omitempty"`
+	}{otp, pgpKey}
+	if err := v.sys(once(ctx), "PUT", "generate-root/attempt", in, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GenerateRootUpdate provides one of the unseal keys to the root token
+// generation with the given nonce.  This does not need a token, and is
+// never retried, since a lost response to the last key would lose the
+// new root token.
+func (v *Vault) GenerateRootUpdate(ctx context.Context, key, nonce string) (*GenerateRootStatus, error) {
+	var s GenerateRootStatus
+	in := struct {
+		Key   string `json:"key"`
+		Nonce string `json:"nonce"`
+	}{key, nonce}
+	if err := v.sys(once(ctx), "PUT", "generate-root/update", in, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CancelGenerateRoot cancels the root token generation in progress,
+// throwing away any unseal keys provided so far.  This does not need a
+// token.
+func (v *Vault) CancelGenerateRoot(ctx context.Context) error {
+	return v.sys(ctx, "DELETE", "generate-root/attempt", nil, nil)
+}
+
+// NewOTP generates a one-time password for starting a root token
+// generation on older Vaults, that don't generate one themselves.
+func NewOTP() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// DecodeRootToken decodes the encoded root token handed out at the end
+// of a root token generation, using the one-time password that it was
+// started with.  Whether the Vault that generated it is a legacy one is
+// up to the Vault to say (see GenerateRootStatus.Legacy).
+func DecodeRootToken(encoded, otp string, legacy bool) (string, error) {
+	if legacy {
+		/* a base64-encoded password, from NewOTP; these Vaults
+		   hand out root tokens that are UUIDs */
+		a, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("invalid encoded root token: %s", err)
+		}
+		b, err := base64.StdEncoding.DecodeString(otp)
+		if err != nil {
+			return "", fmt.Errorf("invalid one-time password: %s", err)
+		}
+		x, err := xor(a, b)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x-%x-%x-%x-%x", x[0:4], x[4:6], x[6:8], x[8:10], x[10:]), nil
+	}
+
+	a, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid encoded root token: %s", err)
+	}
+	x, err := xor(a, []byte(otp))
+	if err != nil {
+		return "", err
+	}
+	return string(x), nil
+}
+
+func xor(a, b []byte) ([]byte, error) {
+	if len(a) != len(b) || len(a) < 16 {
+		return nil, fmt.Errorf("the one-time password does not match the encoded root token")
+	}
+	x := make([]byte, len(a))
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+	return x, nil
+}
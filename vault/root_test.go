@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRootToken(t *testing.T) {
+	xored := func(a, b []byte) []byte {
+		x := make([]byte, len(a))
+		for i := range a {
+			x[i] = a[i] ^ b[i]
+		}
+		return x
+	}
+
+	/* newer Vaults XOR the token with the (plain text) OTP itself */
+	token := "hvs.NEWROOTTOKEN123456789"
+	otp := "Qs8nHk2pL0vXa7RtYb3mWc1zE"[:len(token)]
+	encoded := base64.RawStdEncoding.EncodeToString(xored([]byte(token), []byte(otp)))
+	padded := base64.StdEncoding.EncodeToString(xored([]byte(token), []byte(otp)))
+
+	/* legacy Vaults XOR the 16 bytes of a UUID with a base64-encoded OTP */
+	uuid := []byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x00, 0x11, 0x22, 0x33}
+	pad := []byte("0123456789abcdef")
+	legacyOTP := base64.StdEncoding.EncodeToString(pad)
+	legacyEncoded := base64.StdEncoding.EncodeToString(xored(uuid, pad))
+
+	tests := []struct {
+		name    string
+		encoded string
+		otp     string
+		legacy  bool
+		want    string
+		err     string
+	}{
+		{"new style", encoded, otp, false, token, ""},
+		{"new style, padded", padded, otp, false, token, ""},
+		{"legacy", legacyEncoded, legacyOTP, true, "deadbeef-0123-4567-89ab-cdef00112233", ""},
+		{"new style, with a legacy OTP", encoded, legacyOTP, false, "", "does not match"},
+		{"legacy, with a new style OTP", legacyEncoded, otp, true, "", "invalid one-time password"},
+		{"new style, decoded as legacy", encoded, otp, true, "", "invalid"},
+		{"wrong OTP length", encoded, otp[1:], false, "", "does not match"},
+		{"too short", base64.RawStdEncoding.EncodeToString([]byte("short")), "abcde", false, "", "does not match"},
+		{"not base64", "!!!", otp, false, "", "invalid encoded root token"},
+		{"legacy, not base64", "!!!", legacyOTP, true, "", "invalid encoded root token"},
+	}
+
+	for _, test := range tests {
+		got, err := DecodeRootToken(test.encoded, test.otp, test.legacy)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got %q (error %v), wanted an error containing %q", test.name, got, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: decoded %q, wanted %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGenerateRootStatusLegacy(t *testing.T) {
+	tests := []struct {
+		otpLength int
+		want      bool
+	}{
+		{0, true},
+		{24, false},
+		{28, false},
+	}
+
+	for _, test := range tests {
+		s := &GenerateRootStatus{OTPLength: test.otpLength}
+		if got := s.Legacy(); got != test.want {
+			t.Errorf("Legacy() with an OTP length of %d = %v, wanted %v", test.otpLength, got, test.want)
+		}
+	}
+}
+
+func TestNewOTP(t *testing.T) {
+	otp, err := NewOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := base64.StdEncoding.DecodeString(otp)
+	if err != nil {
+		t.Fatalf("NewOTP() = %q, which is not base64: %s", otp, err)
+	}
+	if len(b) != 16 {
+		t.Errorf("NewOTP() is %d bytes long, wanted 16", len(b))
+	}
+}
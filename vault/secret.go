@@ -1,22 +1,68 @@
 package vault
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/kless/osutil/user/crypt/sha512_crypt"
 )
 
 // A Secret contains a set of key/value pairs that store anything you
-// want, including passwords, RSAKey keys, usernames, etc.
+// want, including passwords, RSAKey keys, usernames, etc.  Values are
+// usually strings, but can be anything that JSON can represent (numbers,
+// booleans, lists and objects); they keep their type when the Secret is
+// read, written, exported or imported.
 type Secret struct {
-	data map[string]string
+	data    map[string]interface{}
+	version int
+	meta    map[string]string
 }
 
 func NewSecret() *Secret {
-	return &Secret{make(map[string]string)}
+	return &Secret{data: make(map[string]interface{})}
+}
+
+// Version returns the version of the Secret, as it was read from a KV v2
+// mount, or 0 for secrets that are not versioned.
+func (s *Secret) Version() int {
+	return s.version
+}
+
+// Metadata returns the custom metadata recorded alongside the Secret,
+// as it was read from a KV v2 mount (by newer Vaults), if any.
+func (s *Secret) Metadata() map[string]string {
+	return s.meta
+}
+
+// clone returns a copy of the Secret that can be modified without
+// affecting the original.
+func (s *Secret) clone() *Secret {
+	c := NewSecret()
+	c.version = s.version
+	c.meta = s.meta
+	for k, v := range s.data {
+		c.data[k] = v
+	}
+	return c
+}
+
+// equal returns true if both Secrets hold exactly the same keys and values.
+func (s *Secret) equal(other *Secret) bool {
+	if len(s.data) != len(other.data) {
+		return false
+	}
+	for k, v := range s.data {
+		if x, ok := other.data[k]; !ok || !reflect.DeepEqual(x, v) {
+			return false
+		}
+	}
+	return true
 }
 
 func (s Secret) MarshalJSON() ([]byte, error) {
@@ -24,7 +70,15 @@ func (s Secret) MarshalJSON() ([]byte, error) {
 }
 
 func (s *Secret) UnmarshalJSON(b []byte) error {
-	return json.Unmarshal(b, &s.data)
+	return decodeJSON(b, &s.data)
+}
+
+// decodeJSON unmarshals JSON, keeping numbers as json.Numbers, so that
+// they make it back out again exactly as they came in.
+func decodeJSON(b []byte, into interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(into)
 }
 
 // Has returns true if the Secret has defined the given key.
@@ -34,9 +88,20 @@ func (s *Secret) Has(key string) bool {
 }
 
 // Get retrieves the value of the given key, or "" if no such key exists.
+// Values that are not strings are returned in their JSON form.
 func (s *Secret) Get(key string) string {
-	x, _ := s.data[key]
-	return x
+	switch x := s.data[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
 }
 
 // Set stores a value in the Secret, under the given key.
@@ -44,6 +109,28 @@ func (s *Secret) Set(key, value string) {
 	s.data[key] = value
 }
 
+// SetValue stores a value of any type that JSON can represent in the
+// Secret, under the given key.
+func (s *Secret) SetValue(key string, value interface{}) {
+	s.data[key] = value
+}
+
+// ParseJSON parses a single JSON value (i.e. 5432, true, ["a","b"] or
+// {"k":"v"}) into something that SetValue can store, keeping numbers
+// exactly as they were written.
+func ParseJSON(value string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	var x interface{}
+	if err := d.Decode(&x); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, fmt.Errorf("trailing data after %s", value)
+	}
+	return x, nil
+}
+
 func (s *Secret) Format(oldKey, newKey, fmtType string) error {
 	if !s.Has(oldKey) {
 		return NotFound
@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+		ok    bool
+	}{
+		{`5432`, json.Number("5432"), true},
+		{`1.50`, json.Number("1.50"), true},
+		{`12345678901234567890`, json.Number("12345678901234567890"), true},
+		{`true`, true, true},
+		{`null`, nil, true},
+		{`"quoted"`, "quoted", true},
+		{` ["a", 1] `, []interface{}{"a", json.Number("1")}, true},
+		{`{"k":{"n":2}}`, map[string]interface{}{"k": map[string]interface{}{"n": json.Number("2")}}, true},
+		{`unquoted`, nil, false},
+		{`{"k":`, nil, false},
+		{`1 2`, nil, false},
+		{`5]`, nil, false},
+		{`{} {}`, nil, false},
+		{``, nil, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseJSON(test.value)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("ParseJSON(%q) = %#v, wanted an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseJSON(%q) failed: %s", test.value, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseJSON(%q) = %#v, wanted %#v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSecretTypes(t *testing.T) {
+	s := NewSecret()
+	s.Set("s", "5432")
+	for key, value := range map[string]string{
+		"n": `5432`,
+		"f": `1.50`,
+		"b": `false`,
+		"l": `["a",1]`,
+		"o": `{"k":"v"}`,
+	} {
+		x, err := ParseJSON(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetValue(key, x)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"s", "5432"},
+		{"n", "5432"},
+		{"f", "1.50"},
+		{"b", "false"},
+		{"l", `["a",1]`},
+		{"o", `{"k":"v"}`},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		if got := s.Get(test.key); got != test.want {
+			t.Errorf("Get(%q) = %q, wanted %q", test.key, got, test.want)
+		}
+	}
+
+	/* the string "5432" must stay a string, and the number a number */
+	want := `{"b":false,"f":1.50,"l":["a",1],"n":5432,"o":{"k":"v"},"s":"5432"}`
+	if got := s.JSON(); got != want {
+		t.Errorf("JSON() = %s, wanted %s", got, want)
+	}
+
+	again := NewSecret()
+	if err := json.Unmarshal([]byte(want), again); err != nil {
+		t.Fatal(err)
+	}
+	if !again.equal(s) {
+		t.Errorf("%s came back as %s", want, again.JSON())
+	}
+}
+
+// TestReadWriteTypes checks that values which aren't strings make it
+// through a read and a write unchanged, as a copy or a move would do.
+func TestReadWriteTypes(t *testing.T) {
+	data := `{"big":12345678901234567890,"db":{"port":5432},"hosts":["a","b"],"on":true,"ratio":1.50,"s":"1.50"}`
+	var written string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`{"data":` + data + `}`))
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		written = string(b)
+		w.WriteHeader(204)
+	}))
+	defer srv.Close()
+
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		mounts: map[string]mount{"secret/": {Type: "kv", Options: map[string]string{"version": "1"}}},
+	}
+	s, err := v.Read(context.Background(), "secret/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Write(context.Background(), "secret/y", s); err != nil {
+		t.Fatal(err)
+	}
+	if written != data {
+		t.Errorf("read\n%s\nbut wrote\n%s", data, written)
+	}
+}
@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// SealStatus describes whether or not a Vault is sealed, and if it is,
+// how far along unsealing it is.
+type SealStatus struct {
+	Initialized bool   `json:"initialized"`
+	Sealed      bool   `json:"sealed"`
+	Threshold   int    `json:"t"`
+	Shares      int    `json:"n"`
+	Progress    int    `json:"progress"`
+	Version     string `json:"version"`
+	ClusterName string `json:"cluster_name"`
+}
+
+// LeaderStatus describes the HA status of a Vault.
+type LeaderStatus struct {
+	HAEnabled     bool   `json:"ha_enabled"`
+	IsSelf        bool   `json:"is_self"`
+	LeaderAddress string `json:"leader_address"`
+}
+
+// InitResult holds the unseal keys and initial root token handed out
+// when a Vault is initialized.
+type InitResult struct {
+	Keys      []string `json:"keys"`
+	RootToken string   `json:"root_token"`
+}
+
+// sys sends a request to one of the sys/ endpoints, and decodes the
+// response into out (unless it is nil).
+func (v *Vault) sys(ctx context.Context, method, path string, in, out interface{}) error {
+	return v.api(ctx, method, "sys/"+path, in, out)
+}
+
+// api sends a request to any other (non-secret) API endpoint, i.e. under
+// auth/token/, and decodes the response into out (unless it is nil).
+func (v *Vault) api(ctx context.Context, method, path string, in, out interface{}) error {
+	body := ""
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = string(b)
+	}
+
+	req, err := http.NewRequest(method, v.url("/v1/%s", path), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 204:
+		return nil
+	default:
+		return NewAPIError(res)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("malformed response from vault: %s", err)
+	}
+	return nil
+}
+
+// SealStatus returns the seal status of the Vault.  This does not need
+// a token.
+func (v *Vault) SealStatus(ctx context.Context) (*SealStatus, error) {
+	var s SealStatus
+	if err := v.sys(ctx, "GET", "seal-status", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LeaderStatus returns the HA status of the Vault, which must be
+// unsealed.  This does not need a token.
+func (v *Vault) LeaderStatus(ctx context.Context) (*LeaderStatus, error) {
+	var l LeaderStatus
+	if err := v.sys(ctx, "GET", "leader", nil, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Seal seals the Vault, after which nothing can be read from (or written
+// to) it until it is unsealed again.
+func (v *Vault) Seal(ctx context.Context) error {
+	return v.sys(ctx, "PUT", "seal", nil, nil)
+}
+
+// Unseal submits one of the unseal keys to the Vault, and returns its
+// seal status afterwards; once enough keys have been submitted, the
+// Vault is unsealed.  This does not need a token.
+func (v *Vault) Unseal(ctx context.Context, key string) (*SealStatus, error) {
+	var s SealStatus
+	in := struct {
+		Key string `json:"key"`
+	}{key}
+	if err := v.sys(ctx, "PUT", "unseal", in, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Initialized returns whether or not the Vault has been initialized.
+// This does not need a token.
+func (v *Vault) Initialized(ctx context.Context) (bool, error) {
+	var r struct {
+		Initialized bool `json:"initialized"`
+	}
+	if err := v.sys(ctx, "GET", "init", nil, &r); err != nil {
+		return false, err
+	}
+	return r.Initialized, nil
+}
+
+// Init initializes a brand new Vault, splitting its master key into the
+// given number of unseal key shares, threshold of which are needed to
+// unseal it.  This does not need a token; Init hands out the root token.
+// It is never retried, since a Vault can only be initialized once.
+func (v *Vault) Init(ctx context.Context, shares, threshold int) (*InitResult, error) {
+	var r InitResult
+	in := struct {
+		Shares    int `json:"secret_shares"`
+		Threshold int `json:"secret_threshold"`
+	}{shares, threshold}
+	if err := v.sys(once(ctx), "PUT", "init", in, &r); err != nil {
+		return nil, err
+	}
+	if r.RootToken == "" || len(r.Keys) == 0 {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+	return &r, nil
+}
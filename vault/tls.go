@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// TLSConfig builds the TLS configuration for talking to the Vault, from
+// the same environment variables that the vault CLI uses:
+//
+//	$VAULT_CACERT           PEM-encoded CA certificate(s) to trust
+//	$VAULT_CAPATH           a directory of PEM-encoded CA certificates
+//	$VAULT_CLIENT_CERT      PEM-encoded client certificate to present
+//	$VAULT_CLIENT_KEY       ... and its private key
+//	$VAULT_TLS_SERVER_NAME  the name to expect on the Vault's certificate
+//	$VAULT_SKIP_VERIFY      don't verify the Vault's certificate at all
+//
+// If neither $VAULT_CACERT nor $VAULT_CAPATH is set, the system's own
+// trusted CAs are used.
+func TLSConfig() (*tls.Config, error) {
+	c := &tls.Config{
+		InsecureSkipVerify: os.Getenv("VAULT_SKIP_VERIFY") != "",
+		ServerName:         os.Getenv("VAULT_TLS_SERVER_NAME"),
+	}
+
+	cacert := os.Getenv("VAULT_CACERT")
+	capath := os.Getenv("VAULT_CAPATH")
+	if cacert != "" || capath != "" {
+		pool := x509.NewCertPool()
+		if cacert != "" {
+			if err := appendCAs(pool, cacert); err != nil {
+				return nil, err
+			}
+		}
+		if capath != "" {
+			files, err := ioutil.ReadDir(capath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CA certificates from %s: %s", capath, err)
+			}
+			for _, f := range files {
+				if f.IsDir() {
+					continue
+				}
+				if err := appendCAs(pool, filepath.Join(capath, f.Name())); err != nil {
+					return nil, err
+				}
+			}
+		}
+		c.RootCAs = pool
+	}
+
+	cert := os.Getenv("VAULT_CLIENT_CERT")
+	key := os.Getenv("VAULT_CLIENT_KEY")
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, fmt.Errorf("both $VAULT_CLIENT_CERT and $VAULT_CLIENT_KEY must be set to use a client certificate")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate %s: %s", cert, err)
+		}
+		c.Certificates = []tls.Certificate{pair}
+	}
+
+	return c, nil
+}
+
+func appendCAs(pool *x509.CertPool, file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read CA certificate %s: %s", file, err)
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return fmt.Errorf("no PEM-encoded CA certificates found in %s", file)
+	}
+	return nil
+}
+
+// NewTransport returns an HTTP transport for talking to the Vault, that
+// honors the proxy settings and TLS configuration (see TLSConfig) found
+// in the environment.
+func NewTransport() (*http.Transport, error) {
+	c, err := TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: c,
+	}, nil
+}
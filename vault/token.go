@@ -0,0 +1,333 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TokenInfo describes a Vault token, as returned by LookupSelf (and
+// LookupToken, or LookupAccessor).
+type TokenInfo struct {
+	DisplayName string
+	Accessor    string
+	Policies    []string
+	Renewable   bool
+	Orphan      bool
+
+	// NumUses is how many more times the token can be used; zero
+	// means that there is no limit.
+	NumUses int
+
+	// TTL is how long the token has left to live, as of the lookup;
+	// zero means that the token never expires (i.e. root tokens).
+	TTL time.Duration
+}
+
+// LookupSelf retrieves information about the token that the Vault is
+// being accessed with.
+func (v *Vault) LookupSelf(ctx context.Context) (*TokenInfo, error) {
+	return v.lookupToken(ctx, "GET", "lookup-self", nil)
+}
+
+// LookupToken retrieves information about another token.
+func (v *Vault) LookupToken(ctx context.Context, token string) (*TokenInfo, error) {
+	return v.lookupToken(ctx, "POST", "lookup", struct {
+		Token string `json:"token"`
+	}{token})
+}
+
+// LookupAccessor retrieves information about the token with the given
+// accessor, without needing the token itself.
+func (v *Vault) LookupAccessor(ctx context.Context, accessor string) (*TokenInfo, error) {
+	return v.lookupToken(ctx, "POST", "lookup-accessor", struct {
+		Accessor string `json:"accessor"`
+	}{accessor})
+}
+
+func (v *Vault) lookupToken(ctx context.Context, method, path string, in interface{}) (*TokenInfo, error) {
+	var r struct {
+		Data *struct {
+			DisplayName string   `json:"display_name"`
+			Accessor    string   `json:"accessor"`
+			Policies    []string `json:"policies"`
+			Renewable   bool     `json:"renewable"`
+			Orphan      bool     `json:"orphan"`
+			NumUses     int      `json:"num_uses"`
+			TTL         int64    `json:"ttl"`
+		} `json:"data"`
+	}
+	if err := v.api(ctx, method, "auth/token/"+path, in, &r); err != nil {
+		return nil, err
+	}
+	if r.Data == nil {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+
+	return &TokenInfo{
+		DisplayName: r.Data.DisplayName,
+		Accessor:    r.Data.Accessor,
+		Policies:    r.Data.Policies,
+		Renewable:   r.Data.Renewable,
+		Orphan:      r.Data.Orphan,
+		NumUses:     r.Data.NumUses,
+		TTL:         time.Duration(r.Data.TTL) * time.Second,
+	}, nil
+}
+
+// RenewSelf renews the token that the Vault is being accessed with, and
+// returns its new TTL.  The increment asks for the token to be valid for
+// that much longer (Vault may grant less); zero leaves it up to Vault.
+func (v *Vault) RenewSelf(ctx context.Context, increment time.Duration) (time.Duration, error) {
+	body := "{}"
+	if increment > 0 {
+		body = fmt.Sprintf(`{"increment":"%ds"}`, int64(increment/time.Second))
+	}
+
+	req, err := http.NewRequest("POST", v.url("/v1/auth/token/renew-self"), strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != 200 {
+		return 0, NewAPIError(res)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	var r struct {
+		Auth *struct {
+			LeaseDuration int64 `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return 0, err
+	}
+	if r.Auth == nil {
+		return 0, fmt.Errorf("malformed response from vault")
+	}
+	return time.Duration(r.Auth.LeaseDuration) * time.Second, nil
+}
+
+// RevokeSelf revokes the token that the Vault is being accessed with
+// (and any child tokens it created), after which it can no longer be
+// used for anything.
+func (v *Vault) RevokeSelf(ctx context.Context) error {
+	req, err := http.NewRequest("POST", v.url("/v1/auth/token/revoke-self"), nil)
+	if err != nil {
+		return err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 204:
+		break
+	default:
+		return NewAPIError(res)
+	}
+
+	return nil
+}
+
+// RevokeToken revokes another token, along with any child tokens that
+// it created.
+func (v *Vault) RevokeToken(ctx context.Context, token string) error {
+	return v.api(ctx, "POST", "auth/token/revoke", struct {
+		Token string `json:"token"`
+	}{token}, nil)
+}
+
+// RevokeAccessor revokes the token with the given accessor (and any
+// child tokens that it created), without needing the token itself.
+func (v *Vault) RevokeAccessor(ctx context.Context, accessor string) error {
+	return v.api(ctx, "POST", "auth/token/revoke-accessor", struct {
+		Accessor string `json:"accessor"`
+	}{accessor}, nil)
+}
+
+// TokenRequest describes a token to be created by CreateToken.  Times
+// are in Vault's format (i.e. 1h, or 3600s); empty fields are left up to
+// Vault (or to the Role, if there is one).
+type TokenRequest struct {
+	Role           string   `json:"-"`
+	Orphan         bool     `json:"-"`
+	Policies       []string `json:"policies,omitempty"`
+	TTL            string   `json:"ttl,omitempty"`
+	ExplicitMaxTTL string   `json:"explicit_max_ttl,omitempty"`
+	Period         string   `json:"period,omitempty"`
+	NumUses        int      `json:"num_uses,omitempty"`
+	DisplayName    string   `json:"display_name,omitempty"`
+	Renewable      *bool    `json:"renewable,omitempty"`
+}
+
+// NewToken holds a token created by CreateToken.
+type NewToken struct {
+	Token     string
+	Accessor  string
+	Policies  []string
+	Renewable bool
+
+	// TTL is how long the token has to live; zero means that it never
+	// expires.
+	TTL time.Duration
+}
+
+// CreateToken creates a new token, as a child of the token that the
+// Vault is being accessed with (unless it is an Orphan, or its Role says
+// otherwise).
+func (v *Vault) CreateToken(ctx context.Context, t TokenRequest) (*NewToken, error) {
+	path := "auth/token/create"
+	if t.Role != "" {
+		path = "auth/token/create/" + t.Role
+	} else if t.Orphan {
+		path = "auth/token/create-orphan"
+	}
+
+	var r struct {
+		Auth *struct {
+			ClientToken   string   `json:"client_token"`
+			Accessor      string   `json:"accessor"`
+			Policies      []string `json:"policies"`
+			Renewable     bool     `json:"renewable"`
+			LeaseDuration int64    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := v.api(ctx, "POST", path, t, &r); err != nil {
+		return nil, err
+	}
+	if r.Auth == nil || r.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+	return &NewToken{
+		Token:     r.Auth.ClientToken,
+		Accessor:  r.Auth.Accessor,
+		Policies:  r.Auth.Policies,
+		Renewable: r.Auth.Renewable,
+		TTL:       time.Duration(r.Auth.LeaseDuration) * time.Second,
+	}, nil
+}
+
+// TokenRole describes a token role, which tokens can be created against
+// (see TokenRequest) to limit (or set) their policies and lifetimes.
+type TokenRole struct {
+	AllowedPolicies    []string
+	DisallowedPolicies []string
+	Orphan             bool
+	Renewable          bool
+
+	// Period makes tokens created against the role periodic, i.e. they
+	// never expire, as long as they are renewed within each period.
+	Period         time.Duration
+	ExplicitMaxTTL time.Duration
+}
+
+// TokenRoles lists the names of all of the token roles.
+func (v *Vault) TokenRoles(ctx context.Context) ([]string, error) {
+	var r struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if err := v.api(ctx, "GET", "auth/token/roles?list=1", nil, &r); err != nil {
+		if IsNotFound(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	sort.Strings(r.Data.Keys)
+	return r.Data.Keys, nil
+}
+
+// TokenRole looks up the named token role, returning the NotFound error
+// if there is no such role.
+func (v *Vault) TokenRole(ctx context.Context, name string) (*TokenRole, error) {
+	var r struct {
+		Data *struct {
+			AllowedPolicies    []string `json:"allowed_policies"`
+			DisallowedPolicies []string `json:"disallowed_policies"`
+			Orphan             bool     `json:"orphan"`
+			Renewable          bool     `json:"renewable"`
+
+			/* newer Vaults call these token_period and
+			   token_explicit_max_ttl; older ones don't */
+			Period              int64 `json:"period"`
+			TokenPeriod         int64 `json:"token_period"`
+			ExplicitMaxTTL      int64 `json:"explicit_max_ttl"`
+			TokenExplicitMaxTTL int64 `json:"token_explicit_max_ttl"`
+		} `json:"data"`
+	}
+	if err := v.api(ctx, "GET", "auth/token/roles/"+name, nil, &r); err != nil {
+		if IsNotFound(err) {
+			return nil, NotFound
+		}
+		return nil, err
+	}
+	if r.Data == nil {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+
+	role := &TokenRole{
+		AllowedPolicies:    r.Data.AllowedPolicies,
+		DisallowedPolicies: r.Data.DisallowedPolicies,
+		Orphan:             r.Data.Orphan,
+		Renewable:          r.Data.Renewable,
+		Period:             time.Duration(r.Data.Period) * time.Second,
+		ExplicitMaxTTL:     time.Duration(r.Data.ExplicitMaxTTL) * time.Second,
+	}
+	if r.Data.TokenPeriod > 0 {
+		role.Period = time.Duration(r.Data.TokenPeriod) * time.Second
+	}
+	if r.Data.TokenExplicitMaxTTL > 0 {
+		role.ExplicitMaxTTL = time.Duration(r.Data.TokenExplicitMaxTTL) * time.Second
+	}
+	return role, nil
+}
+
+// SetTokenRole creates the named token role, or replaces it entirely if
+// it already exists.
+func (v *Vault) SetTokenRole(ctx context.Context, name string, role TokenRole) error {
+	in := struct {
+		AllowedPolicies    []string `json:"allowed_policies"`
+		DisallowedPolicies []string `json:"disallowed_policies"`
+		Orphan             bool     `json:"orphan"`
+		Renewable          bool     `json:"renewable"`
+		Period             int64    `json:"period"`
+		ExplicitMaxTTL     int64    `json:"explicit_max_ttl"`
+	}{
+		AllowedPolicies:    role.AllowedPolicies,
+		DisallowedPolicies: role.DisallowedPolicies,
+		Orphan:             role.Orphan,
+		Renewable:          role.Renewable,
+		Period:             int64(role.Period / time.Second),
+		ExplicitMaxTTL:     int64(role.ExplicitMaxTTL / time.Second),
+	}
+	if in.AllowedPolicies == nil {
+		in.AllowedPolicies = []string{}
+	}
+	if in.DisallowedPolicies == nil {
+		in.DisallowedPolicies = []string{}
+	}
+	return v.api(ctx, "POST", "auth/token/roles/"+name, in, nil)
+}
+
+// DeleteTokenRole deletes the named token role.  Tokens created against
+// it are left alone.
+func (v *Vault) DeleteTokenRole(ctx context.Context, name string) error {
+	return v.api(ctx, "DELETE", "auth/token/roles/"+name, nil, nil)
+}
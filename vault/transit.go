@@ -0,0 +1,264 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TransitKey describes a named encryption key in a transit backend.
+type TransitKey struct {
+	Name                 string
+	Type                 string
+	LatestVersion        int
+	MinDecryptionVersion int
+	MinEncryptionVersion int
+	DeletionAllowed      bool
+	Exportable           bool
+}
+
+// TransitKeyConfig holds the settings of a transit key that can be
+// changed after it is created.  Nil settings are left as they are.
+type TransitKeyConfig struct {
+	MinDecryptionVersion *int  `json:"min_decryption_version,omitempty"`
+	MinEncryptionVersion *int  `json:"min_encryption_version,omitempty"`
+	DeletionAllowed      *bool `json:"deletion_allowed,omitempty"`
+	Exportable           *bool `json:"exportable,omitempty"`
+}
+
+// transit sends a request to the transit backend mounted at backend, and
+// returns the "data" of its response (if any).
+func (v *Vault) transit(ctx context.Context, method, backend, path string, in interface{}) (json.RawMessage, error) {
+	var data []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	res, err := v.Curl(ctx, method, strings.Trim(backend, "/")+"/"+path, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 204:
+		return nil, nil
+	case 404:
+		if method == "GET" {
+			return nil, NotFound
+		}
+		return nil, DecodeErrorResponse(res, body)
+	default:
+		return nil, DecodeErrorResponse(res, body)
+	}
+
+	var r struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err = json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("malformed response from vault: %s", err)
+	}
+	return r.Data, nil
+}
+
+// TransitKeys lists the names of the keys in the transit backend mounted
+// at backend (i.e. "transit").
+func (v *Vault) TransitKeys(ctx context.Context, backend string) ([]string, error) {
+	data, err := v.transit(ctx, "GET", backend, "keys?list=1", nil)
+	if err == NotFound {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Keys []string `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("malformed response from vault: %s", err)
+	}
+	sort.Strings(r.Keys)
+	return r.Keys, nil
+}
+
+// TransitKey looks up the named key in the transit backend mounted at
+// backend, returning the NotFound error if there is no such key.
+func (v *Vault) TransitKey(ctx context.Context, backend, name string) (*TransitKey, error) {
+	data, err := v.transit(ctx, "GET", backend, "keys/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Name                 string `json:"name"`
+		Type                 string `json:"type"`
+		LatestVersion        int    `json:"latest_version"`
+		MinDecryptionVersion int    `json:"min_decryption_version"`
+		MinEncryptionVersion int    `json:"min_encryption_version"`
+		DeletionAllowed      bool   `json:"deletion_allowed"`
+		Exportable           bool   `json:"exportable"`
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("malformed response from vault: %s", err)
+	}
+	return &TransitKey{
+		Name:                 r.Name,
+		Type:                 r.Type,
+		LatestVersion:        r.LatestVersion,
+		MinDecryptionVersion: r.MinDecryptionVersion,
+		MinEncryptionVersion: r.MinEncryptionVersion,
+		DeletionAllowed:      r.DeletionAllowed,
+		Exportable:           r.Exportable,
+	}, nil
+}
+
+// CreateTransitKey creates a new key in the transit backend mounted at
+// backend.  An empty type leaves it up to Vault (aes256-gcm96).
+func (v *Vault) CreateTransitKey(ctx context.Context, backend, name, typ string) error {
+	_, err := v.transit(ctx, "POST", backend, "keys/"+name, struct {
+		Type string `json:"type,omitempty"`
+	}{typ})
+	return err
+}
+
+// RotateTransitKey adds a new version of the named transit key, which
+// is used for encrypting from then on.  Data encrypted with the older
+// versions can still be decrypted (see Rewrap).
+func (v *Vault) RotateTransitKey(ctx context.Context, backend, name string) error {
+	_, err := v.transit(ctx, "POST", backend, "keys/"+name+"/rotate", nil)
+	return err
+}
+
+// ConfigureTransitKey changes the settings of the named transit key.
+func (v *Vault) ConfigureTransitKey(ctx context.Context, backend, name string, c TransitKeyConfig) error {
+	_, err := v.transit(ctx, "POST", backend, "keys/"+name+"/config", c)
+	return err
+}
+
+// Encrypt encrypts each of the plaintexts with the named transit key, in
+// a single batch, and returns the ciphertexts (i.e. "vault:v1:...") in
+// the same order.  A version of 0 uses the latest version of the key.
+func (v *Vault) Encrypt(ctx context.Context, backend, key string, plaintexts [][]byte, version int) ([]string, error) {
+	var in []map[string]string
+	for _, p := range plaintexts {
+		in = append(in, map[string]string{"plaintext": base64.StdEncoding.EncodeToString(p)})
+	}
+	return v.transitBatch(ctx, backend, "encrypt/"+key, in, version, "ciphertext")
+}
+
+// Decrypt decrypts each of the ciphertexts with the named transit key,
+// in a single batch, and returns the plaintexts in the same order.
+func (v *Vault) Decrypt(ctx context.Context, backend, key string, ciphertexts []string) ([][]byte, error) {
+	var in []map[string]string
+	for _, c := range ciphertexts {
+		in = append(in, map[string]string{"ciphertext": c})
+	}
+	out, err := v.transitBatch(ctx, backend, "decrypt/"+key, in, 0, "plaintext")
+	if err != nil {
+		return nil, err
+	}
+
+	var plaintexts [][]byte
+	for i, p := range out {
+		b, err := base64.StdEncoding.DecodeString(p)
+		if err != nil {
+			return nil, fmt.Errorf("malformed plaintext for item %d from vault: %s", i+1, err)
+		}
+		plaintexts = append(plaintexts, b)
+	}
+	return plaintexts, nil
+}
+
+// Rewrap re-encrypts each of the ciphertexts with the given version of
+// the named transit key (0 for the latest), without ever revealing the
+// plaintexts, and returns the new ciphertexts in the same order.
+func (v *Vault) Rewrap(ctx context.Context, backend, key string, ciphertexts []string, version int) ([]string, error) {
+	var in []map[string]string
+	for _, c := range ciphertexts {
+		in = append(in, map[string]string{"ciphertext": c})
+	}
+	return v.transitBatch(ctx, backend, "rewrap/"+key, in, version, "ciphertext")
+}
+
+// transitBatch sends a batch of inputs to one of the transit operations,
+// and returns the given field of each of the results.
+func (v *Vault) transitBatch(ctx context.Context, backend, op string, in []map[string]string, version int, field string) ([]string, error) {
+	if len(in) == 0 {
+		return []string{}, nil
+	}
+
+	body := map[string]interface{}{"batch_input": in}
+	if version > 0 {
+		body["key_version"] = version
+	}
+	data, err := v.transit(ctx, "POST", backend, op, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Results []map[string]interface{} `json:"batch_results"`
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("malformed response from vault: %s", err)
+	}
+	if len(r.Results) != len(in) {
+		return nil, fmt.Errorf("malformed response from vault: %d results for %d inputs", len(r.Results), len(in))
+	}
+
+	var out []string
+	var errs []string
+	for i, result := range r.Results {
+		if e, ok := result["error"].(string); ok && e != "" {
+			errs = append(errs, "item "+strconv.Itoa(i+1)+": "+e)
+			continue
+		}
+		s, _ := result[field].(string)
+		out = append(out, s)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return out, nil
+}
+
+// DataKey asks the transit backend for a new 256-bit data key, and
+// returns it both in the clear, for encrypting data locally, and wrapped
+// (encrypted) with the named transit key, for storing alongside that
+// data.  The wrapped key can be unwrapped again with Decrypt.
+func (v *Vault) DataKey(ctx context.Context, backend, key string) ([]byte, string, error) {
+	data, err := v.transit(ctx, "POST", backend, "datakey/plaintext/"+key, struct {
+		Bits int `json:"bits"`
+	}{256})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var r struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, "", fmt.Errorf("malformed response from vault: %s", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(r.Plaintext)
+	if err != nil || len(plaintext) != 32 || r.Ciphertext == "" {
+		return nil, "", fmt.Errorf("malformed data key from vault")
+	}
+	return plaintext, r.Ciphertext, nil
+}
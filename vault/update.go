@@ -0,0 +1,80 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MaxUpdateAttempts is how many times Update will try to apply a change
+// to a secret that keeps being modified by someone else, before giving up.
+const MaxUpdateAttempts = 5
+
+// strictCAS returns true if $SAFE_CAS asks for conflicting updates to
+// fail, rather than be retried.
+func strictCAS() bool {
+	t := os.Getenv("SAFE_CAS")
+	return t != "" && t != "0" && t != "false" && t != "no" && t != "off"
+}
+
+// Update reads the secret at the given path (or starts with an empty one,
+// if there is nothing there yet), lets f modify it, and writes it back,
+// provided nobody else has changed the secret in the meantime.
+//
+// On KV v2 mounts, this uses Vault's own check-and-set, with the version
+// of the secret that was read.  KV v1 has no such thing, so Update reads
+// the secret again right before writing it, and compares the two; this
+// narrows the window for lost updates, but cannot close it entirely.
+//
+// If the secret was modified, Update starts over, calling f again on the
+// newer secret, up to MaxUpdateAttempts times.  With StrictCAS, it gives
+// up right away.  Either way, a *ConflictError is returned on failure.
+func (v *Vault) Update(ctx context.Context, path string, f func(*Secret) error) error {
+	for attempt := 1; ; attempt++ {
+		err := v.update(ctx, path, f)
+		if !IsConflict(err) || v.StrictCAS || attempt >= MaxUpdateAttempts {
+			return err
+		}
+		/* back off a little, so that whoever we are racing
+		   against has a chance to finish first */
+		wait := v.Retry.backoff(attempt, nil)
+		if shouldDebug() {
+			fmt.Fprintf(os.Stderr, "%s was modified while updating it; trying again in %s (attempt %d of %d)\n----------------\n",
+				path, wait, attempt+1, MaxUpdateAttempts)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (v *Vault) update(ctx context.Context, path string, f func(*Secret) error) error {
+	orig, err := v.Read(ctx, path)
+	if err != nil && err != NotFound {
+		return err
+	}
+	/* on NotFound, orig is empty, but still carries the
+	   version of a deleted KV v2 secret (if any) */
+	s := orig.clone()
+	if err = f(s); err != nil {
+		return err
+	}
+
+	if _, _, ok := v.kv2(ctx, path); ok {
+		return v.write(ctx, path, s, orig.version)
+	}
+
+	now, err := v.Read(ctx, path)
+	if err == NotFound {
+		now = NewSecret()
+	} else if err != nil {
+		return err
+	}
+	if !now.equal(orig) {
+		return &ConflictError{Path: path}
+	}
+	return v.write(ctx, path, s, -1)
+}
@@ -0,0 +1,279 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// casVault is a fake Vault with a KV v1 mount at secret/ and a KV v2
+// mount at kv/, each holding a single secret, x.  Its hooks let tests
+// get in the way of Update, the way someone else writing to the same
+// secret would.
+type casVault struct {
+	sync.Mutex
+	data    map[string]map[string]interface{}
+	version int
+	reads   int
+	writes  []string
+
+	// beforeRead and beforeWrite are called (with the lock held)
+	// before each read and write of a secret.
+	beforeRead  func(n int)
+	beforeWrite func(n int)
+
+	// lose makes the next write take effect, but answer with a 503,
+	// as if its response had been lost.
+	lose bool
+}
+
+func (c *casVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	path = strings.Replace(path, "kv/data/", "kv/", 1)
+	switch r.Method {
+	case "GET":
+		c.reads++
+		if c.beforeRead != nil {
+			c.beforeRead(c.reads)
+		}
+		data, ok := c.data[path]
+		if !ok {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		if strings.HasPrefix(path, "kv/") {
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": c.version},
+			}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+
+	case "PUT", "POST":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		c.writes = append(c.writes, path)
+		if c.beforeWrite != nil {
+			c.beforeWrite(len(c.writes))
+		}
+		if strings.HasPrefix(path, "kv/") {
+			if opts, ok := body["options"].(map[string]interface{}); ok {
+				if cas, ok := opts["cas"].(float64); ok && int(cas) != c.version {
+					w.WriteHeader(400)
+					w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+					return
+				}
+			}
+			body, _ = body["data"].(map[string]interface{})
+			c.version++
+		}
+		c.data[path] = body
+		if c.lose {
+			c.lose = false
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// set changes a key of a secret behind Update's back.
+func (c *casVault) set(path, key, value string) {
+	data := make(map[string]interface{})
+	for k, v := range c.data[path] {
+		data[k] = v
+	}
+	data[key] = value
+	c.data[path] = data
+	if strings.HasPrefix(path, "kv/") {
+		c.version++
+	}
+}
+
+func newCASVault() (*casVault, *Vault, func()) {
+	c := &casVault{
+		data: map[string]map[string]interface{}{
+			"secret/x": {"a": "1"},
+			"kv/x":     {"a": "1"},
+		},
+		version: 1,
+	}
+	srv := httptest.NewServer(c)
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		Retry:  RetryPolicy{MaxAttempts: 3, Wait: time.Millisecond, MaxWait: time.Millisecond},
+		mounts: map[string]mount{
+			"secret/": {Type: "kv", Options: map[string]string{"version": "1"}},
+			"kv/":     {Type: "kv", Options: map[string]string{"version": "2"}},
+		},
+	}
+	return c, v, srv.Close
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		strict bool
+		setup  func(c *casVault)
+
+		calls  int               // how many times the change is made
+		writes int               // how many writes reach the Vault
+		want   map[string]string // what the secret ends up as
+		err    string
+	}{
+		{
+			name: "kv v2", path: "kv/x",
+			calls: 1, writes: 1,
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name: "kv v1", path: "secret/x",
+			calls: 1, writes: 1,
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name: "kv v2, modified before writing", path: "kv/x",
+			setup: func(c *casVault) {
+				c.beforeWrite = func(n int) {
+					if n == 1 {
+						c.set("kv/x", "c", "3")
+					}
+				}
+			},
+			calls: 2, writes: 2,
+			want: map[string]string{"a": "1", "b": "2", "c": "3"},
+		},
+		{
+			name: "kv v1, modified before writing", path: "secret/x",
+			setup: func(c *casVault) {
+				/* between the read and the re-read */
+				c.beforeRead = func(n int) {
+					if n == 2 {
+						c.set("secret/x", "c", "3")
+					}
+				}
+			},
+			calls: 2, writes: 1,
+			want: map[string]string{"a": "1", "b": "2", "c": "3"},
+		},
+		{
+			name: "kv v2, modified before writing, strictly", path: "kv/x", strict: true,
+			setup: func(c *casVault) {
+				c.beforeWrite = func(n int) { c.set("kv/x", "c", "3") }
+			},
+			calls: 1, writes: 1,
+			want: map[string]string{"a": "1", "c": "3"},
+			err:  "modified by someone else",
+		},
+		{
+			name: "kv v1, modified before writing, strictly", path: "secret/x", strict: true,
+			setup: func(c *casVault) {
+				c.beforeRead = func(n int) {
+					if n == 2 {
+						c.set("secret/x", "c", "3")
+					}
+				}
+			},
+			calls: 1, writes: 0,
+			err: "modified by someone else",
+		},
+		{
+			name: "kv v2, always modified", path: "kv/x",
+			setup: func(c *casVault) {
+				c.beforeWrite = func(n int) { c.set("kv/x", "c", "3") }
+			},
+			calls: MaxUpdateAttempts, writes: MaxUpdateAttempts,
+			err: "modified by someone else",
+		},
+		{
+			name: "kv v2, response lost", path: "kv/x",
+			setup: func(c *casVault) { c.lose = true },
+			calls: 1, writes: 1,
+			want: map[string]string{"a": "1", "b": "2"},
+			err:  "503",
+		},
+	}
+
+	for _, test := range tests {
+		c, v, done := newCASVault()
+		v.StrictCAS = test.strict
+		if test.setup != nil {
+			test.setup(c)
+		}
+
+		calls := 0
+		err := v.Update(context.Background(), test.path, func(s *Secret) error {
+			calls++
+			s.Set("b", "2")
+			return nil
+		})
+		done()
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, wanted one containing %q", test.name, err, test.err)
+		}
+		if strings.Contains(test.err, "modified") && !IsConflict(err) {
+			t.Errorf("%s: got %v, wanted a *ConflictError", test.name, err)
+		}
+		if calls != test.calls {
+			t.Errorf("%s: the change was made %d times, wanted %d", test.name, calls, test.calls)
+		}
+		if len(c.writes) != test.writes {
+			t.Errorf("%s: %d writes reached the Vault (%v), wanted %d", test.name, len(c.writes), c.writes, test.writes)
+		}
+		if test.want != nil {
+			got := make(map[string]string)
+			for k, v := range c.data[test.path] {
+				got[k], _ = v.(string)
+			}
+			if len(got) != len(test.want) {
+				t.Errorf("%s: ended up with %v, wanted %v", test.name, got, test.want)
+				continue
+			}
+			for k, v := range test.want {
+				if got[k] != v {
+					t.Errorf("%s: ended up with %v, wanted %v", test.name, got, test.want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateNew(t *testing.T) {
+	c, v, done := newCASVault()
+	defer done()
+
+	/* a secret that doesn't exist yet can only be created once */
+	c.beforeWrite = func(n int) {
+		if n == 1 {
+			c.set("kv/y", "z", "9")
+		}
+	}
+	c.version = 0
+	err := v.Update(context.Background(), "kv/y", func(s *Secret) error {
+		s.Set("b", "2")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.data["kv/y"]["z"] != "9" || c.data["kv/y"]["b"] != "2" {
+		t.Errorf("ended up with %v, wanted both z and b", c.data["kv/y"])
+	}
+}
@@ -2,26 +2,43 @@ package vault
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"os"
+	"strconv"
 	"strings"
-
-	"github.com/starkandwayne/goutils/ansi"
-	"github.com/starkandwayne/goutils/tree"
+	"sync"
+	"time"
 )
 
 // A Vault represents a means for interacting with a remote Vault
 // instance (unsealed and pre-authenticated) to read and write secrets.
 type Vault struct {
-	URL    string
-	Token  string
-	Client *http.Client
+	URL       string
+	Token     string
+	Namespace string
+	Client    *http.Client
+
+	// Concurrency limits how many requests are made at once when
+	// operating on entire trees of secrets.
+	Concurrency int
+
+	// Retry governs how requests that fail for transient reasons
+	// are retried.
+	Retry RetryPolicy
+
+	// StrictCAS makes Update fail as soon as it finds that someone else
+	// has modified the secret being updated, instead of trying again.
+	StrictCAS bool
+
+	mounts     map[string]mount
+	mountsLock sync.Mutex
+	slots      chan struct{}
+	slotsOnce  sync.Once
 }
 
 // NewVault creates a new Vault object.  If an empty token is specified,
@@ -39,24 +56,64 @@ func NewVault(url, token string) (*Vault, error) {
 		return nil, fmt.Errorf("no vault token specified; are you authenticated?")
 	}
 
+	return newVault(url, token)
+}
+
+// NewUnauthenticatedVault returns a Vault for the parts of the API that
+// can be used without a token, like checking the seal status of a Vault,
+// unsealing it, or initializing it in the first place.
+func NewUnauthenticatedVault(url string) (*Vault, error) {
+	return newVault(url, "")
+}
+
+func newVault(url, token string) (*Vault, error) {
+	client, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Vault{
-		URL:   url,
-		Token: token,
-		Client: &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: os.Getenv("VAULT_SKIP_VERIFY") != "",
-				},
-			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) > 10 {
-					return fmt.Errorf("stopped after 10 redirects")
-				}
-				req.Header.Add("X-Vault-Token", token)
-				return nil
-			},
-		},
+		URL:       url,
+		Token:     token,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+
+		Concurrency: concurrency(),
+		Retry:       retryPolicy(),
+		StrictCAS:   strictCAS(),
+		Client:      client,
+	}, nil
+}
+
+// DefaultTimeout is how long to wait for a single request to the Vault
+// to complete, unless overridden via $VAULT_CLIENT_TIMEOUT.
+const DefaultTimeout = 60 * time.Second
+
+// timeout parses $VAULT_CLIENT_TIMEOUT, which can either be a duration
+// (i.e. "90s" or "2m") or a number of seconds.  A timeout of 0 means
+// that requests never time out.
+func timeout() time.Duration {
+	t := os.Getenv("VAULT_CLIENT_TIMEOUT")
+	if d, err := time.ParseDuration(t); err == nil && d >= 0 {
+		return d
+	}
+	if n, err := strconv.Atoi(t); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// NewClient returns an HTTP client for talking to the Vault, using the
+// transport from NewTransport, the request timeout from the environment,
+// and leaving redirects for the caller to handle (see FollowRedirect).
+func NewClient() (*http.Client, error) {
+	transport, err := NewTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       timeout(),
+		CheckRedirect: noRedirects,
 	}, nil
 }
 
@@ -69,7 +126,9 @@ func shouldDebug() bool {
 	return d != "" && d != "false" && d != "0" && d != "no" && d != "off"
 }
 
-func (v *Vault) request(req *http.Request) (*http.Response, error) {
+func (v *Vault) request(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+
 	var (
 		body []byte
 		err  error
@@ -81,8 +140,16 @@ func (v *Vault) request(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	req.Header.Add("X-Vault-Token", v.Token)
-	for i := 0; i < 10; i++ {
+	if v.Token != "" {
+		req.Header.Add("X-Vault-Token", v.Token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	origin := req.URL
+	redirects := 0
+	for attempt := 1; ; attempt++ {
 		if req.Body != nil {
 			req.Body = ioutil.NopCloser(bytes.NewReader(body))
 		}
@@ -91,44 +158,83 @@ func (v *Vault) request(req *http.Request) (*http.Response, error) {
 			fmt.Fprintf(os.Stderr, "Request:\n%s\n----------------\n", r)
 		}
 		res, err := v.Client.Do(req)
-		if shouldDebug() {
+		if ctx.Err() != nil {
+			/* interrupted, or timed out; don't bother retrying */
+			if res != nil {
+				res.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if shouldDebug() && res != nil {
 			r, _ := httputil.DumpResponse(res, true)
 			fmt.Fprintf(os.Stderr, "Response:\n%s\n----------------\n", r)
 		}
+
+		if attempt < v.Retry.MaxAttempts && v.Retry.retryable(req, res, err) {
+			wait := v.Retry.backoff(attempt, res)
+			if shouldDebug() {
+				why := ""
+				if err != nil {
+					why = err.Error()
+				} else {
+					why = res.Status
+				}
+				fmt.Fprintf(os.Stderr, "Retrying %s %s in %s (attempt %d of %d): %s\n----------------\n",
+					req.Method, req.URL, wait, attempt+1, v.Retry.MaxAttempts, why)
+			}
+			if res != nil {
+				res.Body.Close()
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
-		// Vault returns a 307 to redirect during HA / Auth
-		switch res.StatusCode {
-		case 307:
-			// Note: this does not handle relative Location headers
-			url, err := url.Parse(res.Header.Get("Location"))
-			if err != nil {
-				return nil, err
-			}
-			req.URL = url
-			// ... and try again.
 
-		default:
-			return res, err
+		// Vault returns a 307 to redirect during HA / Auth
+		if !IsRedirect(res) {
+			return res, nil
+		}
+		res.Body.Close()
+		redirects++
+		if redirects > MaxRedirects {
+			return nil, fmt.Errorf("redirection loop detected")
+		}
+		if err = FollowRedirect(req, res, origin); err != nil {
+			return nil, err
 		}
+		// ... and try again.
+		attempt--
 	}
-
-	return nil, fmt.Errorf("redirection loop detected")
 }
 
-func (v *Vault) Curl(method string, path string, body []byte) (*http.Response, error) {
+func (v *Vault) Curl(ctx context.Context, method string, path string, body []byte) (*http.Response, error) {
 	req, err := http.NewRequest(method, v.url("/v1/%s", path), bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
-	return v.request(req)
+	return v.request(ctx, req)
 }
 
 // Read checks the Vault for a Secret at the specified path, and returns it.
 // If there is nothing at that path, a nil *Secret will be returned, with no
 // error.
-func (v *Vault) Read(path string) (secret *Secret, err error) {
+//
+// A specific version of a secret on a KV v2 mount can be retrieved by
+// appending "@" and the version number to the path, i.e. secret/x@3.
+// Elsewhere, "@" is just another character in the path.
+func (v *Vault) Read(ctx context.Context, path string) (secret *Secret, err error) {
+	var version int
+	if bare, n := splitVersion(path); n > 0 {
+		if _, _, ok := v.kv2(ctx, strings.SplitN(bare, ":", 2)[0]); ok {
+			path, version = bare, n
+		}
+	}
 	s := strings.SplitN(path, ":", 2)
 	var key string
 	if len(s) == 2 {
@@ -136,11 +242,15 @@ func (v *Vault) Read(path string) (secret *Secret, err error) {
 		key = s[1]
 	}
 	secret = NewSecret()
-	req, err := http.NewRequest("GET", v.url("/v1/%s", path), nil)
+	u := v.url("/v1/%s", v.kvPath(ctx, path, "data"))
+	if version > 0 {
+		u = fmt.Sprintf("%s?version=%d", u, version)
+	}
+	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		return
 	}
-	res, err := v.request(req)
+	res, err := v.request(ctx, req)
 	if err != nil {
 		return
 	}
@@ -149,10 +259,24 @@ func (v *Vault) Read(path string) (secret *Secret, err error) {
 	case 200:
 		break
 	case 404:
+		/* deleted KV v2 secrets still have a version, which
+		   Update needs to know for its check-and-set */
+		if _, _, v2 := v.kv2(ctx, path); v2 {
+			var r struct {
+				Data struct {
+					Metadata struct {
+						Version int `json:"version"`
+					} `json:"metadata"`
+				} `json:"data"`
+			}
+			if json.NewDecoder(res.Body).Decode(&r) == nil {
+				secret.version = r.Data.Metadata.Version
+			}
+		}
 		err = NotFound
 		return
 	default:
-		err = fmt.Errorf("API %s", res.Status)
+		err = NewAPIError(res)
 		return
 	}
 
@@ -162,25 +286,45 @@ func (v *Vault) Read(path string) (secret *Secret, err error) {
 	}
 
 	var raw map[string]interface{}
-	if err = json.Unmarshal(b, &raw); err != nil {
+	if err = decodeJSON(b, &raw); err != nil {
 		return
 	}
 
-	if rawdata, ok := raw["data"]; ok {
+	rawdata, ok := raw["data"]
+	if _, _, v2 := v.kv2(ctx, path); v2 && ok {
+		/* KV v2 nests the secret itself one level deeper,
+		   alongside its version metadata */
 		if data, ok := rawdata.(map[string]interface{}); ok {
-			for k, v := range data {
-				if (key != "" && k == key) || key == "" {
-					if s, ok := v.(string); ok {
-						secret.data[k] = s
-					} else {
-						b, err = json.Marshal(v)
-						if err != nil {
-							return
+			if meta, ok := data["metadata"].(map[string]interface{}); ok {
+				if n, ok := meta["version"].(json.Number); ok {
+					if n, err := n.Int64(); err == nil {
+						secret.version = int(n)
+					}
+				}
+				if custom, ok := meta["custom_metadata"].(map[string]interface{}); ok {
+					secret.meta = make(map[string]string)
+					for k, v := range custom {
+						if s, ok := v.(string); ok {
+							secret.meta[k] = s
 						}
-						secret.data[k] = string(b)
 					}
 				}
 			}
+			if data["data"] == nil {
+				err = NotFound
+				return
+			}
+			rawdata = data["data"]
+		}
+	}
+
+	if ok {
+		if data, ok := rawdata.(map[string]interface{}); ok {
+			for k, v := range data {
+				if (key != "" && k == key) || key == "" {
+					secret.data[k] = v
+				}
+			}
 
 			return
 		}
@@ -192,12 +336,12 @@ func (v *Vault) Read(path string) (secret *Secret, err error) {
 // List returns the set of (relative) paths that are directly underneath
 // the given path.  Intermediate path nodes are suffixed with a single "/",
 // whereas leaf nodes (the secrets themselves) are not.
-func (v *Vault) List(path string) (paths []string, err error) {
-	req, err := http.NewRequest("GET", v.url("/v1/%s?list=1", path), nil)
+func (v *Vault) List(ctx context.Context, path string) (paths []string, err error) {
+	req, err := http.NewRequest("GET", v.url("/v1/%s?list=1", v.kvPath(ctx, path, "metadata")), nil)
 	if err != nil {
 		return
 	}
-	res, err := v.request(req)
+	res, err := v.request(ctx, req)
 	if err != nil {
 		return
 	}
@@ -206,11 +350,11 @@ func (v *Vault) List(path string) (paths []string, err error) {
 	case 200:
 		break
 	case 404:
-		req, err = http.NewRequest("GET", v.url("/v1/%s", path), nil)
+		req, err = http.NewRequest("GET", v.url("/v1/%s", v.kvPath(ctx, path, "data")), nil)
 		if err != nil {
 			return
 		}
-		res, err = v.request(req)
+		res, err = v.request(ctx, req)
 		if err != nil {
 			return
 		}
@@ -221,11 +365,11 @@ func (v *Vault) List(path string) (paths []string, err error) {
 			err = NotFound
 			return
 		default:
-			err = fmt.Errorf("API %s", res.Status)
+			err = NewAPIError(res)
 			return
 		}
 	default:
-		err = fmt.Errorf("API %s", res.Status)
+		err = NewAPIError(res)
 		return
 	}
 
@@ -246,65 +390,41 @@ type Node struct {
 	Children []Node
 }
 
-// Tree returns a tree that represents the hierarhcy of paths contained
-// below the given path, inside of the Vault.
-func (v *Vault) Tree(path string, ansify bool) (tree.Node, error) {
-	name := path
-	if ansify {
-		name = ansi.Sprintf("@C{%s}", path)
-	}
-	t := tree.New(name)
-
-	l, err := v.List(path)
-	if err != nil {
-		return t, err
-	}
-
-	var kid tree.Node
-	for _, p := range l {
-		var shouldAppend bool
-		if p[len(p)-1:len(p)] == "/" {
-			kid, err = v.Tree(path+"/"+p[0:len(p)-1], ansify)
-			if len(kid.Sub) > 0 {
-				shouldAppend = true
-			}
-			if ansify {
-				name = ansi.Sprintf("@B{%s}", p)
-			} else {
-				name = p[0 : len(p)-1]
-			}
-		} else {
-			shouldAppend = true
-			if ansify {
-				name = ansi.Sprintf("@G{%s}", p)
-			} else {
-				name = p
-			}
-			kid = tree.New(name)
-		}
-		if err != nil {
-			return t, err
-		}
-		kid.Name = name
-		if shouldAppend {
-			t.Append(kid)
-		}
-	}
-	return t, nil
+// Write takes a Secret and writes it to the Vault at the specified path.
+func (v *Vault) Write(ctx context.Context, path string, s *Secret) error {
+	return v.write(ctx, path, s, -1)
 }
 
-// Write takes a Secret and writes it to the Vault at the specified path.
-func (v *Vault) Write(path string, s *Secret) error {
+// write does the actual writing for Write and Update.  If cas is not
+// negative, and the path is on a KV v2 mount, Vault is told to only
+// accept the write if the current version of the secret is cas (where 0
+// means that the secret must not exist yet); if it isn't, a
+// *ConflictError is returned.  Check-and-set writes are never retried.
+func (v *Vault) write(ctx context.Context, path string, s *Secret, cas int) error {
 	raw := s.JSON()
 	if raw == "" {
 		return fmt.Errorf("nothing to write")
 	}
+	if _, _, ok := v.kv2(ctx, path); ok {
+		if cas >= 0 {
+			raw = fmt.Sprintf(`{"options":{"cas":%d},"data":%s}`, cas, raw)
+			/* if the write took, but its response was lost, trying
+			   again would only fail the check-and-set, and Update
+			   would then apply its change a second time */
+			ctx = once(ctx)
+		} else {
+			raw = fmt.Sprintf(`{"data":%s}`, raw)
+		}
+	}
 
-	req, err := http.NewRequest("POST", v.url("/v1/%s", path), strings.NewReader(raw))
+	/* Vault treats PUT and POST the same, but a PUT tells
+	   request() that the write is safe to retry (unless it is
+	   a check-and-set) */
+	req, err := http.NewRequest("PUT", v.url("/v1/%s", v.kvPath(ctx, path, "data")), strings.NewReader(raw))
 	if err != nil {
 		return err
 	}
-	res, err := v.request(req)
+	res, err := v.request(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -315,33 +435,41 @@ func (v *Vault) Write(path string, s *Secret) error {
 	case 204:
 		break
 	default:
-		return fmt.Errorf("API %s", res.Status)
+		e := NewAPIError(res)
+		if cas >= 0 && e.StatusCode == 400 && strings.Contains(strings.Join(e.Errors, " "), "check-and-set") {
+			return &ConflictError{Path: path}
+		}
+		return e
 	}
 
 	return nil
 }
 
-func (v *Vault) DeleteTree(root string) error {
-	tree, err := v.Tree(root, false)
+// DeleteTree removes every secret underneath root (and root itself),
+// using the given function (i.e. Delete or DestroyAll) for each path.
+func (v *Vault) DeleteTree(ctx context.Context, root string, f func(context.Context, string) error) error {
+	tree, err := v.Tree(ctx, root, TreeOptions{})
 	if err != nil {
 		return err
 	}
-	for _, path := range tree.Paths("/") {
-		err = v.Delete(path)
-		if err != nil {
-			return err
-		}
+	err = v.each(ctx, tree.Paths("/"), f)
+	if err != nil {
+		return err
 	}
-	return v.Delete(root)
+	if err = f(ctx, root); err != nil && err != NotFound {
+		return err
+	}
+	return nil
 }
 
-// Delete removes the secret stored at the specified path.
-func (v *Vault) Delete(path string) error {
-	req, err := http.NewRequest("DELETE", v.url("/v1/%s", path), nil)
+// Delete removes the secret stored at the specified path.  On KV v2
+// mounts, this only deletes the latest version of the secret.
+func (v *Vault) Delete(ctx context.Context, path string) error {
+	req, err := http.NewRequest("DELETE", v.url("/v1/%s", v.kvPath(ctx, path, "data")), nil)
 	if err != nil {
 		return err
 	}
-	res, err := v.request(req)
+	res, err := v.request(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -352,55 +480,60 @@ func (v *Vault) Delete(path string) error {
 	case 204:
 		break
 	default:
-		return fmt.Errorf("API %s", res.Status)
+		return NewAPIError(res)
 	}
 
 	return nil
 }
 
 // Copy copies secrets from one path to another.
-func (v *Vault) Copy(oldpath, newpath string) error {
-	secret, err := v.Read(oldpath)
+func (v *Vault) Copy(ctx context.Context, oldpath, newpath string) error {
+	secret, err := v.Read(ctx, oldpath)
 	if err != nil {
 		return err
 	}
-	return v.Write(newpath, secret)
+	return v.Write(ctx, newpath, secret)
 }
 
-func (v *Vault) MoveCopyTree(oldRoot, newRoot string, f func(string, string) error) error {
-	tree, err := v.Tree(oldRoot, false)
+func (v *Vault) MoveCopyTree(ctx context.Context, oldRoot, newRoot string, f func(context.Context, string, string) error) error {
+	tree, err := v.Tree(ctx, oldRoot, TreeOptions{})
 	if err != nil {
 		return err
 	}
-	for _, path := range tree.Paths("/") {
+	err = v.each(ctx, tree.Paths("/"), func(ctx context.Context, path string) error {
 		newPath := strings.Replace(path, oldRoot, newRoot, 1)
-		err = f(path, newPath)
-		if err != nil {
+		if err := f(ctx, path, newPath); err != nil && err != NotFound {
 			return err
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if _, err := v.Read(oldRoot); err != NotFound { // run through a copy unless we successfully got a 404 from this node
-		return f(oldRoot, newRoot)
+	if _, err := v.Read(ctx, oldRoot); err != NotFound { // run through a copy unless we successfully got a 404 from this node
+		return f(ctx, oldRoot, newRoot)
 	}
 	return nil
 }
 
 // Move moves secrets from one path to another.
-func (v *Vault) Move(oldpath, newpath string) error {
-	err := v.Copy(oldpath, newpath)
+func (v *Vault) Move(ctx context.Context, oldpath, newpath string) error {
+	err := v.Copy(ctx, oldpath, newpath)
 	if err != nil {
 		return err
 	}
-	err = v.Delete(oldpath)
+	err = v.Delete(ctx, oldpath)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (v *Vault) RetrievePem(path string) ([]byte, error) {
-	res, err := v.Curl("GET", "/pki/"+path+"/pem", nil)
+// RetrievePem retrieves the PEM-encoded CA certificate ("ca") or CRL
+// ("crl") from the PKI backend mounted at backend (i.e. "pki").
+func (v *Vault) RetrievePem(ctx context.Context, backend, path string) ([]byte, error) {
+	res, err := v.Curl(ctx, "GET", strings.Trim(backend, "/")+"/"+path+"/pem", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -411,36 +544,12 @@ func (v *Vault) RetrievePem(path string) ([]byte, error) {
 	}
 
 	if res.StatusCode != 200 {
-		return nil, DecodeErrorResponse(body)
+		return nil, DecodeErrorResponse(res, body)
 	}
 
 	return body, nil
 }
 
-func DecodeErrorResponse(body []byte) error {
-	var raw map[string]interface{}
-
-	if err := json.Unmarshal(body, &raw); err != nil {
-		return fmt.Errorf("Received non-200 with non-JSON payload:\n%s\n", body)
-	}
-
-	if rawErrors, ok := raw["errors"]; ok {
-		var errors []string
-		if elems, ok := rawErrors.([]interface{}); ok {
-			for _, elem := range elems {
-				if err, ok := elem.(string); ok {
-					errors = append(errors, err)
-				}
-			}
-			return fmt.Errorf(strings.Join(errors, "\n"))
-		} else {
-			return fmt.Errorf("Received unexpected format of Vault error messages:\n%v\n", errors)
-		}
-	} else {
-		return fmt.Errorf("Received non-200 with no error messagess:\n%v\n", raw)
-	}
-}
-
 type CertOptions struct {
 	CN                string `json:"common_name"`
 	TTL               string `json:"ttl,omitempty"`
@@ -449,7 +558,10 @@ type CertOptions struct {
 	ExcludeCNFromSans bool   `json:"exclude_cn_from_sans,omitempty"`
 }
 
-func (v *Vault) CreateSignedCertificate(role, path string, params CertOptions) error {
+// CreateSignedCertificate issues a certificate from the given role of the
+// PKI backend mounted at backend, and stores it (and its key and serial)
+// at path.
+func (v *Vault) CreateSignedCertificate(ctx context.Context, backend, role, path string, params CertOptions) error {
 	parts := strings.Split(path, "/")
 	cn := parts[len(parts)-1]
 	params.CN = cn
@@ -458,7 +570,7 @@ func (v *Vault) CreateSignedCertificate(role, path string, params CertOptions) e
 	if err != nil {
 		return err
 	}
-	res, err := v.Curl("POST", fmt.Sprintf("pki/issue/%s", role), data)
+	res, err := v.Curl(ctx, "POST", fmt.Sprintf("%s/issue/%s", strings.Trim(backend, "/"), role), data)
 	if err != nil {
 		return err
 	}
@@ -469,7 +581,7 @@ func (v *Vault) CreateSignedCertificate(role, path string, params CertOptions) e
 	}
 
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("Unable to create certificate %s: %s\n", cn, DecodeErrorResponse(body))
+		return fmt.Errorf("Unable to create certificate %s: %w\n", cn, DecodeErrorResponse(res, body))
 	}
 
 	var raw map[string]interface{}
@@ -498,29 +610,29 @@ func (v *Vault) CreateSignedCertificate(role, path string, params CertOptions) e
 					return fmt.Errorf("Invalid data type for serial_number %s:\n%v\n", cn, data)
 				}
 
-				secret, err := v.Read(path)
-				if err != nil && err != NotFound {
-					return err
-				}
-				secret.Set("cert", cert)
-				secret.Set("key", key)
-				secret.Set("serial", serial)
-				return v.Write(path, secret)
+				return v.Update(ctx, path, func(secret *Secret) error {
+					secret.Set("cert", cert)
+					secret.Set("key", key)
+					secret.Set("serial", serial)
+					return nil
+				})
 			} else {
-				fmt.Errorf("Invalid response datatype requesting certificate %s:\n%v\n", cn, d)
+				return fmt.Errorf("Invalid response datatype requesting certificate %s:\n%v\n", cn, d)
 			}
 		} else {
-			fmt.Errorf("No data found when requesting certificate %s:\n%v\n", cn, d)
+			return fmt.Errorf("No data found when requesting certificate %s:\n%v\n", cn, d)
 		}
 	} else {
 		return fmt.Errorf("Unparseable json creating certificate %s:\n%s\n", cn, body)
 	}
-	return nil
 }
 
-func (v *Vault) RevokeCertificate(serial string) error {
+// RevokeCertificate revokes a certificate issued by the PKI backend
+// mounted at backend, given either its serial number, or the path that
+// it was stored at by CreateSignedCertificate.
+func (v *Vault) RevokeCertificate(ctx context.Context, backend, serial string) error {
 	if strings.ContainsRune(serial, '/') {
-		secret, err := v.Read(serial)
+		secret, err := v.Read(ctx, serial)
 		if err != nil {
 			return err
 		}
@@ -539,7 +651,7 @@ func (v *Vault) RevokeCertificate(serial string) error {
 		return err
 	}
 
-	res, err := v.Curl("POST", "pki/revoke", data)
+	res, err := v.Curl(ctx, "POST", strings.Trim(backend, "/")+"/revoke", data)
 	if err != nil {
 		return err
 	}
@@ -549,7 +661,7 @@ func (v *Vault) RevokeCertificate(serial string) error {
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("Unable to revoke certificate %s: %s\n", serial, DecodeErrorResponse(body))
+		return fmt.Errorf("Unable to revoke certificate %s: %w\n", serial, DecodeErrorResponse(res, body))
 	}
 	return nil
 }
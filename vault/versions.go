@@ -0,0 +1,189 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A SecretVersion describes a single version of a secret stored on a
+// KV v2 mount.  Deleted and Created are zero if unset.
+type SecretVersion struct {
+	Version   int
+	Created   time.Time
+	Deleted   time.Time
+	Destroyed bool
+}
+
+// splitVersion separates a trailing "@<version>" from a path, returning
+// the bare path and the requested version (or 0, if none was given).
+func splitVersion(path string) (string, int) {
+	i := strings.LastIndex(path, "@")
+	if i < 0 {
+		return path, 0
+	}
+	n, err := strconv.ParseUint(path[i+1:], 10, 32)
+	if err != nil || n == 0 {
+		return path, 0
+	}
+	return path[:i], int(n)
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Versions returns the version history of the secret at the given path,
+// oldest first.  The path must be on a KV v2 mount.
+func (v *Vault) Versions(ctx context.Context, path string) ([]SecretVersion, error) {
+	m, err := v.metadata(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []SecretVersion
+	for n, info := range m.Versions {
+		version, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("malformed response from vault")
+		}
+		versions = append(versions, SecretVersion{
+			Version:   version,
+			Created:   parseTime(info.Created),
+			Deleted:   parseTime(info.Deleted),
+			Destroyed: info.Destroyed,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+// Rollback writes a previous version of the secret at the given path
+// back as the newest version.  The path must be on a KV v2 mount, and
+// versions that have been deleted or destroyed cannot be rolled back to.
+func (v *Vault) Rollback(ctx context.Context, path string, version int) error {
+	if _, _, ok := v.kv2(ctx, path); !ok {
+		return fmt.Errorf("%s is not on a versioned (KV v2) mount", path)
+	}
+
+	s, err := v.Read(ctx, fmt.Sprintf("%s@%d", path, version))
+	if err == NotFound {
+		return fmt.Errorf("version %d of %s does not exist, or has been deleted or destroyed", version, path)
+	}
+	if err != nil {
+		return err
+	}
+	return v.Write(ctx, path, s)
+}
+
+// latest returns the current version number of the secret at path.
+func (v *Vault) latest(ctx context.Context, path string) (int, error) {
+	versions, err := v.Versions(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, NotFound
+	}
+	return versions[len(versions)-1].Version, nil
+}
+
+// versionsOp sends a list of versions to one of the KV v2 version
+// management endpoints (delete, undelete or destroy).  If no versions
+// are given, the operation applies to the latest version of the secret.
+func (v *Vault) versionsOp(ctx context.Context, endpoint, path string, versions []int) error {
+	if _, _, ok := v.kv2(ctx, path); !ok {
+		return fmt.Errorf("%s is not on a versioned (KV v2) mount", path)
+	}
+
+	if len(versions) == 0 {
+		n, err := v.latest(ctx, path)
+		if err != nil {
+			return err
+		}
+		versions = []int{n}
+	}
+
+	b, err := json.Marshal(struct {
+		Versions []int `json:"versions"`
+	}{versions})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", v.url("/v1/%s", v.kvPath(ctx, path, endpoint)), strings.NewReader(string(b)))
+	if err != nil {
+		return err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 204:
+		break
+	case 404:
+		return NotFound
+	default:
+		return NewAPIError(res)
+	}
+
+	return nil
+}
+
+// Undelete restores previously deleted versions of a secret on a KV v2
+// mount (or the latest version, if none are given).
+func (v *Vault) Undelete(ctx context.Context, path string, versions []int) error {
+	return v.versionsOp(ctx, "undelete", path, versions)
+}
+
+// Destroy permanently removes the data of the given versions of a secret
+// on a KV v2 mount (or the latest version, if none are given).  Unlike
+// Delete, this cannot be undone.
+func (v *Vault) Destroy(ctx context.Context, path string, versions []int) error {
+	return v.versionsOp(ctx, "destroy", path, versions)
+}
+
+// DestroyAll permanently removes every version of a secret, along with
+// all of its metadata.  For unversioned paths, this is the same as Delete.
+func (v *Vault) DestroyAll(ctx context.Context, path string) error {
+	if _, _, ok := v.kv2(ctx, path); !ok {
+		return v.Delete(ctx, path)
+	}
+
+	req, err := http.NewRequest("DELETE", v.url("/v1/%s", v.kvPath(ctx, path, "metadata")), nil)
+	if err != nil {
+		return err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		break
+	case 204:
+		break
+	case 404:
+		return NotFound
+	default:
+		return NewAPIError(res)
+	}
+
+	return nil
+}
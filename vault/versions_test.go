@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		version int
+	}{
+		{"secret/x", "secret/x", 0},
+		{"secret/x@3", "secret/x", 3},
+		{"secret/x:key@12", "secret/x:key", 12},
+		{"secret/me@example.com@2", "secret/me@example.com", 2},
+		{"secret/me@example.com", "secret/me@example.com", 0},
+		{"secret/x@", "secret/x@", 0},
+		{"secret/x@0", "secret/x@0", 0},
+		{"secret/x@-1", "secret/x@-1", 0},
+		{"secret/x@1.5", "secret/x@1.5", 0},
+		{"secret/x@99999999999", "secret/x@99999999999", 0},
+	}
+
+	for _, test := range tests {
+		path, version := splitVersion(test.path)
+		if path != test.want || version != test.version {
+			t.Errorf("splitVersion(%q) = %q, %d; wanted %q, %d", test.path, path, version, test.want, test.version)
+		}
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	var requested string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.RequestURI()
+		w.WriteHeader(404)
+		w.Write([]byte(`{"errors":[]}`))
+	}))
+	defer srv.Close()
+
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		mounts: map[string]mount{
+			"secret/": {Type: "kv", Options: map[string]string{"version": "1"}},
+			"kv/":     {Type: "kv", Options: map[string]string{"version": "2"}},
+		},
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"kv/x", "/v1/kv/data/x"},
+		{"kv/x@3", "/v1/kv/data/x?version=3"},
+		{"kv/x:key@3", "/v1/kv/data/x?version=3"},
+		{"kv/me@example.com@2", "/v1/kv/data/me@example.com?version=2"},
+		{"secret/x@3", "/v1/secret/x@3"},
+		{"secret/x:key@3", "/v1/secret/x"},
+		{"nowhere/x@3", "/v1/nowhere/x@3"},
+	}
+
+	for _, test := range tests {
+		requested = ""
+		if _, err := v.Read(context.Background(), test.path); err != NotFound {
+			t.Errorf("Read(%q) returned %v, wanted NotFound", test.path, err)
+		}
+		if requested != test.want {
+			t.Errorf("Read(%q) requested %q, wanted %q", test.path, requested, test.want)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	var requests []string
+	var written string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch {
+		case r.Method == "GET" && r.URL.Query().Get("version") == "1":
+			w.Write([]byte(`{"data":{"data":{"a":"old"},"metadata":{"version":1}}}`))
+		case r.Method == "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			written = string(b)
+			w.WriteHeader(204)
+		default:
+			/* every other version has been deleted */
+			w.WriteHeader(404)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	v := &Vault{
+		URL:    srv.URL,
+		Client: srv.Client(),
+		mounts: map[string]mount{
+			"secret/": {Type: "kv", Options: map[string]string{"version": "1"}},
+			"kv/":     {Type: "kv", Options: map[string]string{"version": "2"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		version  int
+		err      string
+		requests []string
+	}{
+		{"kv v2", "kv/x", 1, "", []string{"GET /v1/kv/data/x?version=1", "PUT /v1/kv/data/x"}},
+		{"deleted version", "kv/x", 2, "version 2 of kv/x does not exist", []string{"GET /v1/kv/data/x?version=2"}},
+		{"kv v1", "secret/x", 1, "secret/x is not on a versioned (KV v2) mount", nil},
+		{"no mount", "nowhere/x", 1, "nowhere/x is not on a versioned (KV v2) mount", nil},
+	}
+
+	for _, test := range tests {
+		requests, written = nil, ""
+		err := v.Rollback(context.Background(), test.path, test.version)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, wanted one containing %q", test.name, err, test.err)
+		}
+		if strings.Join(requests, ", ") != strings.Join(test.requests, ", ") {
+			t.Errorf("%s: made requests %v, wanted %v", test.name, requests, test.requests)
+		}
+		if test.err == "" && written != `{"data":{"a":"old"}}` {
+			t.Errorf("%s: wrote %s, wanted the old version's data", test.name, written)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+)
+
+// DefaultConcurrency is the number of requests that will be in flight
+// at once when walking, reading or modifying entire trees of secrets,
+// unless overridden via $SAFE_CONCURRENCY.
+const DefaultConcurrency = 8
+
+func concurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("SAFE_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultConcurrency
+}
+
+// acquire blocks until one of the Vault's concurrent request slots is
+// free, and takes it, unless the context is done first.  Callers must
+// release() the slot when done (if acquire didn't fail).
+func (v *Vault) acquire(ctx context.Context) error {
+	v.slotsOnce.Do(func() {
+		n := v.Concurrency
+		if n < 1 {
+			n = 1
+		}
+		v.slots = make(chan struct{}, n)
+	})
+	select {
+	case v.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (v *Vault) release() {
+	<-v.slots
+}
+
+// each calls f once for every path, with no more than v.Concurrency
+// calls running at the same time.  If any of the calls fail, the error
+// for the earliest such path (in the order given) is returned.
+//
+// If the context is cancelled (or times out) part of the way through,
+// no further calls are started, and an *IncompleteError is returned
+// to tell which paths were processed, and which were not.
+func (v *Vault) each(ctx context.Context, paths []string, f func(context.Context, string) error) error {
+	errs := make([]error, len(paths))
+	for i := range errs {
+		errs[i] = context.Canceled
+	}
+
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		if v.acquire(ctx) != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			defer v.release()
+			errs[i] = f(ctx, path)
+		}(i, path)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		e := &IncompleteError{Err: ctx.Err()}
+		for i, path := range paths {
+			if errs[i] == nil {
+				e.Done = append(e.Done, path)
+			} else {
+				e.Pending = append(e.Pending, path)
+			}
+		}
+		return e
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TreeOptions control what Tree includes in the trees it returns, and
+// how it is rendered.
+type TreeOptions struct {
+	// Ansify colors the names of paths and secrets, for display.
+	Ansify bool
+
+	// Meta appends the custom metadata of each secret on a KV v2
+	// mount (if it has any) to its name, for display.
+	Meta bool
+}
+
+// Tree returns a tree that represents the hierarhcy of paths contained
+// below the given path, inside of the Vault.  Sub-trees are listed in
+// parallel, but the result is always sorted.
+func (v *Vault) Tree(ctx context.Context, path string, opts TreeOptions) (tree.Node, error) {
+	name := path
+	if opts.Ansify {
+		name = ansi.Sprintf("@C{%s}", path)
+	}
+	t := tree.New(name)
+
+	if err := v.acquire(ctx); err != nil {
+		return t, err
+	}
+	l, err := v.List(ctx, path)
+	v.release()
+	if err != nil {
+		return t, err
+	}
+	sort.Strings(l)
+
+	kids := make([]tree.Node, len(l))
+	errs := make([]error, len(l))
+
+	var wg sync.WaitGroup
+	for i, p := range l {
+		if p[len(p)-1:len(p)] == "/" {
+			wg.Add(1)
+			go func(i int, p string) {
+				defer wg.Done()
+				kids[i], errs[i] = v.Tree(ctx, path+"/"+p[0:len(p)-1], opts)
+				if opts.Ansify {
+					kids[i].Name = ansi.Sprintf("@B{%s}", p)
+				} else {
+					kids[i].Name = p[0 : len(p)-1]
+				}
+			}(i, p)
+		} else {
+			if opts.Ansify {
+				kids[i] = tree.New(ansi.Sprintf("@G{%s}", p))
+			} else {
+				kids[i] = tree.New(p)
+			}
+			if opts.Meta {
+				wg.Add(1)
+				go func(i int, p string) {
+					defer wg.Done()
+					errs[i] = v.annotate(ctx, &kids[i], path+"/"+p, opts)
+				}(i, p)
+			}
+		}
+	}
+	wg.Wait()
+
+	for i, p := range l {
+		if errs[i] != nil {
+			return t, errs[i]
+		}
+		/* skip sub-trees that turned out to be empty */
+		if p[len(p)-1:len(p)] != "/" || len(kids[i].Sub) > 0 {
+			t.Append(kids[i])
+		}
+	}
+	return t, nil
+}
+
+// annotate appends the custom metadata of the secret at path (if any)
+// to the name of its node in a tree.
+func (v *Vault) annotate(ctx context.Context, node *tree.Node, path string, opts TreeOptions) error {
+	if _, _, ok := v.kv2(ctx, path); !ok {
+		return nil
+	}
+	if err := v.acquire(ctx); err != nil {
+		return err
+	}
+	m, err := v.Metadata(ctx, path)
+	v.release()
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if len(m) == 0 {
+		return nil
+	}
+
+	if opts.Ansify {
+		node.Name += ansi.Sprintf("  @Y{[%s]}", FormatMetadata(m))
+	} else {
+		node.Name += fmt.Sprintf("  [%s]", FormatMetadata(m))
+	}
+	return nil
+}
+
+// ReadAll reads the secrets at each of the given paths, in parallel.
+// Paths with nothing to read (i.e. deleted KV v2 secrets) are skipped.
+func (v *Vault) ReadAll(ctx context.Context, paths []string) (map[string]*Secret, error) {
+	var lock sync.Mutex
+	secrets := make(map[string]*Secret)
+
+	err := v.each(ctx, paths, func(ctx context.Context, path string) error {
+		s, err := v.Read(ctx, path)
+		if err == NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		secrets[path] = s
+		lock.Unlock()
+		return nil
+	})
+	return secrets, err
+}
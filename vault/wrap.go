@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WrapInfo describes a response-wrapping token, as handed out by Wrap.
+type WrapInfo struct {
+	Token    string
+	Accessor string
+	TTL      time.Duration
+	Created  time.Time
+}
+
+// Wrap reads the secret at the given path (which may name a single key,
+// or a specific version) and wraps it up in a single-use token that
+// expires after ttl (i.e. "1h" or "30m").  Whoever holds the token can
+// retrieve the secret exactly once, via Unwrap, without needing access
+// to the path it came from.
+func (v *Vault) Wrap(ctx context.Context, path, ttl string) (*WrapInfo, error) {
+	s, err := v.Read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", v.url("/v1/sys/wrapping/wrap"), strings.NewReader(s.JSON()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Wrap-TTL", ttl)
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, NewAPIError(res)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		WrapInfo *struct {
+			Token    string `json:"token"`
+			Accessor string `json:"accessor"`
+			TTL      int    `json:"ttl"`
+			Created  string `json:"creation_time"`
+		} `json:"wrap_info"`
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	if r.WrapInfo == nil || r.WrapInfo.Token == "" {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+
+	return &WrapInfo{
+		Token:    r.WrapInfo.Token,
+		Accessor: r.WrapInfo.Accessor,
+		TTL:      time.Duration(r.WrapInfo.TTL) * time.Second,
+		Created:  parseTime(r.WrapInfo.Created),
+	}, nil
+}
+
+// Unwrap exchanges a response-wrapping token (from Wrap) for the secret
+// wrapped up in it.  Since wrapping tokens are single-use, this can only
+// ever succeed once for any given token.
+func (v *Vault) Unwrap(ctx context.Context, token string) (*Secret, error) {
+	b, err := json.Marshal(struct {
+		Token string `json:"token"`
+	}{token})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", v.url("/v1/sys/wrapping/unwrap"), strings.NewReader(string(b)))
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, NewAPIError(res)
+	}
+
+	b, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = decodeJSON(b, &r); err != nil {
+		return nil, err
+	}
+	if r.Data == nil {
+		return nil, fmt.Errorf("malformed response from vault")
+	}
+	return &Secret{data: r.Data}, nil
+}